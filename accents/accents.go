@@ -0,0 +1,47 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+// Package accents folds the accented Latin letters to their base letters, for
+// the comparisons and the file names that ignore accents.
+package accents
+
+import "strings"
+
+// accentPairs maps the accented Latin letters to their base letters.
+var accentPairs = []string{
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ý", "y", "ÿ", "y", "ß", "ss",
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A", "Æ", "AE",
+	"Ç", "C", "È", "E", "É", "E", "Ê", "E", "Ë", "E",
+	"Ì", "I", "Í", "I", "Î", "I", "Ï", "I", "Ñ", "N",
+	"Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ø", "O", "Œ", "OE",
+	"Ù", "U", "Ú", "U", "Û", "U", "Ü", "U", "Ý", "Y",
+}
+
+var replacer = strings.NewReplacer(accentPairs...)
+
+// forms lists, for each lowercase base letter, its accented forms.
+var forms = func() map[rune]string {
+	forms := make(map[rune]string)
+	for i := 0; i+1 < len(accentPairs); i += 2 {
+		accented, base := []rune(accentPairs[i]), []rune(accentPairs[i+1])
+		if len(base) == 1 && base[0] >= 'a' && base[0] <= 'z' {
+			forms[base[0]] += string(accented)
+		}
+	}
+	return forms
+}()
+
+// Remove replaces the accented Latin letters of s by their base letters.
+func Remove(s string) string {
+	return replacer.Replace(s)
+}
+
+// Forms returns the accented forms of a lowercase base letter: "àáâãäå" for
+// 'a'.
+func Forms(base rune) string {
+	return forms[base]
+}
@@ -0,0 +1,21 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package accents
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemove(t *testing.T) {
+	assert.Equal(t, "Fevrier aout Decembre oeuvre", Remove("Février août Décembre œuvre"))
+	assert.Equal(t, "ABC 12", Remove("ABC 12"))
+}
+
+func TestForms(t *testing.T) {
+	assert.Equal(t, "èéêë", Forms('e'))
+	assert.Empty(t, Forms('b'))
+	assert.Empty(t, Forms('E'), "only lowercase letters have forms")
+}
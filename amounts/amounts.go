@@ -0,0 +1,252 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+// Package amounts parses the amounts of money written in documents, with their
+// currency, whatever their decimal convention, and formats them back.
+package amounts
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Convention tells which of the point and the comma is the decimal separator.
+type Convention int
+
+const (
+	// Auto guesses the decimal separator of each amount: the last of the point
+	// and the comma when both are written, else the one that follows thousands
+	// grouped with spaces or is not followed by a group of three digits.
+	Auto Convention = iota
+	// DecimalComma reads 1.234,56 as 1234.56.
+	DecimalComma
+	// DecimalPoint reads 1,234.56 as 1234.56.
+	DecimalPoint
+)
+
+// ParseConvention converts the name of a convention, "auto", "comma" or
+// "point".
+func ParseConvention(name string) (Convention, error) {
+	switch name {
+	case "auto":
+		return Auto, nil
+	case "comma":
+		return DecimalComma, nil
+	case "point":
+		return DecimalPoint, nil
+	default:
+		return Auto, fmt.Errorf("decimal must be auto, comma or point, got %q", name)
+	}
+}
+
+// Symbols maps the currency symbols to their ISO 4217 codes.
+var Symbols = map[string]string{"€": "EUR", "$": "USD", "£": "GBP", "¥": "JPY"}
+
+// codes are the active ISO 4217 currency codes. Other words of three capital
+// letters, such as TVA or TTC, are not currencies.
+var codes = strings.Fields(`
+	AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BRL BSD BTN BWP BYN BZD
+	CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD
+	GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT
+	LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR
+	NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP
+	STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VES VND VUV WST XAF XCD XCG
+	XOF XPF YER ZAR ZMW ZWG`)
+
+// Amount is an amount of money. Value is its decimal value, written with a
+// point and without thousands separators, and Currency its ISO 4217 code,
+// empty when it is unknown.
+type Amount struct {
+	Value    string
+	Currency string
+}
+
+// String returns the amount as a file name friendly text: 1234.56EUR.
+func (a Amount) String() string {
+	return a.Value + a.Currency
+}
+
+// Float returns the value as a float, 0 for the zero Amount.
+func (a Amount) Float() float64 {
+	f, _ := strconv.ParseFloat(a.Value, 64)
+	return f
+}
+
+// separators are the thousands and decimal separators of the locales.
+var separators = map[string][2]string{
+	"plain": {"", "."},
+	"en":    {",", "."},
+	"fr":    {" ", ","},
+	"de":    {".", ","},
+	"ch":    {"'", "."},
+}
+
+// Format writes the value with the separators of a locale: "plain"
+// (1234.56), "en" (1,234.56), "fr" (1 234,56), "de" (1.234,56) or "ch"
+// (1'234.56).
+func (a Amount) Format(locale string) (string, error) {
+	sep, ok := separators[locale]
+	if !ok {
+		return "", fmt.Errorf("locale must be plain, en, fr, de or ch, got %q", locale)
+	}
+	sign, value := "", a.Value
+	if strings.HasPrefix(value, "-") {
+		sign, value = "-", value[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(value, ".")
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, d := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(sep[0])
+		}
+		b.WriteRune(d)
+	}
+	if hasFraction {
+		b.WriteString(sep[1] + fraction)
+	}
+	return b.String(), nil
+}
+
+// Parser parses amounts. Currency is the currency of the amounts written
+// without one. Currencies adds symbols or abbreviations to Symbols. The zero
+// value guesses the decimal separator and leaves the currency empty.
+type Parser struct {
+	Decimal    Convention
+	Currency   string
+	Currencies map[string]string
+}
+
+var (
+	codeRegexp   = regexp.MustCompile(`\b[A-Z]{3}\b`)
+	numberRegexp = regexp.MustCompile(`^([+-]?)\s*([0-9][0-9 .,'\x{00A0}\x{202F}]*)$`)
+	groupRegexp  = regexp.MustCompile(`[ .,'\x{00A0}\x{202F}]`)
+)
+
+// Parse reads an amount such as "1.234,56 €", "€1,234.56", "1 234,56 EUR" or
+// "-12.5". The currency is given by a symbol or a known ISO 4217 code, before
+// or after the number.
+func (p Parser) Parse(s string) (Amount, error) {
+	rest, currency := p.currency(strings.TrimSpace(s))
+	sm := numberRegexp.FindStringSubmatch(strings.TrimSpace(rest))
+	if sm == nil {
+		return Amount{}, fmt.Errorf("no amount in %q", s)
+	}
+	value, err := p.normalize(strings.TrimRight(sm[2], " \u00a0\u202f"))
+	if err != nil {
+		return Amount{}, fmt.Errorf("%q: %w", s, err)
+	}
+	if currency == "" {
+		currency = p.Currency
+	}
+	if sm[1] == "-" && strings.Trim(value, "0.") != "" {
+		value = "-" + value
+	}
+	return Amount{Value: value, Currency: currency}, nil
+}
+
+// currency removes the currency from s and returns its code. Longer symbols
+// are looked for first, so that "CHF" wins over a configured "CH".
+func (p Parser) currency(s string) (string, string) {
+	symbols := make(map[string]string, len(Symbols)+len(p.Currencies))
+	for symbol, code := range Symbols {
+		symbols[symbol] = code
+	}
+	for symbol, code := range p.Currencies {
+		symbols[symbol] = code
+	}
+	keys := make([]string, 0, len(symbols))
+	for symbol := range symbols {
+		keys = append(keys, symbol)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	for _, symbol := range keys {
+		if i := strings.Index(s, symbol); i >= 0 {
+			return s[:i] + " " + s[i+len(symbol):], symbols[symbol]
+		}
+	}
+	for _, loc := range codeRegexp.FindAllStringIndex(s, -1) {
+		if code := s[loc[0]:loc[1]]; p.isCode(code) {
+			return s[:loc[0]] + " " + s[loc[1]:], code
+		}
+	}
+	return s, ""
+}
+
+// isCode tells whether a word is a known ISO 4217 code or the code of a
+// configured currency.
+func (p Parser) isCode(word string) bool {
+	if word == p.Currency || slices.Contains(codes, word) {
+		return true
+	}
+	for _, code := range p.Currencies {
+		if word == code {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize removes the thousands separators of a number and writes its
+// decimal separator as a point.
+func (p Parser) normalize(number string) (string, error) {
+	integer, fraction := number, ""
+	if i := p.decimalIndex(number); i >= 0 {
+		integer, fraction = number[:i], number[i+1:]
+		if fraction == "" || strings.Trim(fraction, "0123456789") != "" {
+			return "", fmt.Errorf("invalid decimals %q", fraction)
+		}
+	}
+	groups := groupRegexp.Split(integer, -1)
+	for i, g := range groups {
+		if g == "" || len(g) > 3 && len(groups) > 1 || i > 0 && len(g) != 3 {
+			return "", fmt.Errorf("invalid thousands in %q", number)
+		}
+	}
+	integer = strings.TrimLeft(strings.Join(groups, ""), "0")
+	if integer == "" {
+		integer = "0"
+	}
+	if fraction == "" {
+		return integer, nil
+	}
+	return integer + "." + fraction, nil
+}
+
+// decimalIndex returns the index of the decimal separator of a number, or -1
+// when it has none.
+func (p Parser) decimalIndex(number string) int {
+	point, comma := strings.LastIndexByte(number, '.'), strings.LastIndexByte(number, ',')
+	switch p.Decimal {
+	case DecimalComma:
+		return comma
+	case DecimalPoint:
+		return point
+	}
+	if point >= 0 && comma >= 0 {
+		return max(point, comma)
+	}
+	i, separator := max(point, comma), ","
+	if point >= 0 {
+		separator = "."
+	}
+	switch {
+	case i < 0, strings.Count(number, separator) > 1:
+		return -1
+	case strings.ContainsAny(number[:i], " '\u00a0\u202f"):
+		return i
+	case len(number)-i-1 == 3 && strings.TrimLeft(number[:i], "0") != "": //nolint:mnd
+		return -1
+	default:
+		return i
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package amounts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	p := Parser{}
+	tests := map[string]Amount{
+		"1.234,56 €":       {"1234.56", "EUR"},
+		"€1,234.56":        {"1234.56", "EUR"},
+		"1 234,56 EUR":     {"1234.56", "EUR"},
+		"1 234,56 €":       {"1234.56", "EUR"},
+		"$ 3":              {"3", "USD"},
+		"12.50 GBP":        {"12.50", "GBP"},
+		"CHF 1'250.00":     {"1250.00", "CHF"},
+		"1.234":            {"1234", ""},
+		"1,234":            {"1234", ""},
+		"0,125":            {"0.125", ""},
+		"12,5":             {"12.5", ""},
+		"1,234,567":        {"1234567", ""},
+		"-42,00 €":         {"-42.00", "EUR"},
+		"+7 USD":           {"7", "USD"},
+		" 007.10 ":         {"7.10", ""},
+		"1 234 567,891 ¥ ": {"1234567.891", "JPY"},
+	}
+	for s, wants := range tests {
+		a, err := p.Parse(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, wants, a, s)
+		}
+	}
+
+	p = Parser{Decimal: DecimalComma, Currency: "EUR", Currencies: map[string]string{"Fr.": "CHF"}}
+	a, err := p.Parse("1.234")
+	require.NoError(t, err)
+	assert.Equal(t, Amount{"1234", "EUR"}, a)
+	a, err = p.Parse("12,345")
+	require.NoError(t, err)
+	assert.Equal(t, Amount{"12.345", "EUR"}, a)
+	a, err = p.Parse("Fr. 12,50")
+	require.NoError(t, err)
+	assert.Equal(t, Amount{"12.50", "CHF"}, a)
+
+	p.Decimal = DecimalPoint
+	a, err = p.Parse("1,234")
+	require.NoError(t, err)
+	assert.Equal(t, Amount{"1234", "EUR"}, a)
+
+	p = Parser{Currencies: map[string]string{"Fr.": "XBT"}}
+	a, err = p.Parse("12.50 XBT")
+	require.NoError(t, err)
+	assert.Equal(t, Amount{"12.50", "XBT"}, a, "the code of a configured currency")
+}
+
+func TestParse_Invalid(t *testing.T) {
+	p := Parser{}
+	for _, s := range []string{"", "EUR", "total", "12 34", "1.2.3,4", "12,", "1234,567.89", "12 € 34", "TVA 12,50", "12,50 TTC"} {
+		_, err := p.Parse(s)
+		assert.Error(t, err, s)
+	}
+	_, err := Parser{Decimal: DecimalComma}.Parse("1.23")
+	assert.Error(t, err)
+}
+
+func TestFormat(t *testing.T) {
+	a := Amount{Value: "-1234567.5", Currency: "EUR"}
+	assert.Equal(t, "-1234567.5EUR", a.String())
+	assert.InDelta(t, -1234567.5, a.Float(), 0)
+	for locale, wants := range map[string]string{
+		"plain": "-1234567.5",
+		"en":    "-1,234,567.5",
+		"fr":    "-1 234 567,5",
+		"de":    "-1.234.567,5",
+		"ch":    "-1'234'567.5",
+	} {
+		s, err := a.Format(locale)
+		require.NoError(t, err)
+		assert.Equal(t, wants, s, locale)
+	}
+	s, err := Amount{Value: "123"}.Format("en")
+	require.NoError(t, err)
+	assert.Equal(t, "123", s)
+	_, err = a.Format("xx")
+	assert.ErrorContains(t, err, "locale must be")
+}
+
+func TestParseConvention(t *testing.T) {
+	for name, wants := range map[string]Convention{"auto": Auto, "comma": DecimalComma, "point": DecimalPoint} {
+		c, err := ParseConvention(name)
+		require.NoError(t, err)
+		assert.Equal(t, wants, c)
+	}
+	_, err := ParseConvention("dot")
+	assert.ErrorContains(t, err, "decimal must be auto, comma or point")
+}
@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,7 +21,13 @@ import (
 	"github.com/knadh/koanf/v2"
 	"github.com/spf13/pflag"
 
+	"fileganizer/amounts"
+	"fileganizer/dates"
+	"fileganizer/filter"
+	"fileganizer/grok"
 	"fileganizer/logger"
+	"fileganizer/matcher"
+	"fileganizer/sanitize"
 )
 
 func formatVersion(version string) string {
@@ -61,6 +70,7 @@ func formatVersion(version string) string {
 		output += fmt.Sprintf("%-15s: %s\n", "Last Commit", lastCommit)
 	}
 	output += fmt.Sprintf("%-15s: %s\n", "Go Version", info.GoVersion)
+	output += fmt.Sprintf("%-15s: %s\n", "Grok Patterns", grok.LibraryVersion)
 	return output
 }
 
@@ -73,6 +83,11 @@ type cliFlags struct {
 	InputFile   string
 	TextOutput  bool
 	NoDryRun    bool
+	Explain     bool
+	Strict      bool
+	Now         string
+	KeepGoing   bool
+	Report      string
 	ShowVersion bool
 }
 
@@ -83,6 +98,12 @@ func parseFlags(args []string) (cliFlags, error) {
 	inputFile := fs.StringP("file", "f", "", "File to scan")
 	textOutput := fs.BoolP("text-output", "t", false, "Show extracted text")
 	noDryRun := fs.BoolP("run", "r", false, "No Dry run with output of the command. Really run it !")
+	explain := fs.BoolP("explain", "e", false, "Explain which descriptions and patterns match, without rendering outputs")
+	strict := fs.BoolP("strict", "s", false, "Fail on templates using missing fields and on outputs that fail to render")
+	now := fs.String("now", "", "Date and time used as now by the templates (2006-01-02, 2006-01-02T15:04:05 or RFC 3339)")
+	keepGoing := fs.BoolP("keep-going", "k", false,
+		"Go on with the other file descriptions when one fails, and report the failures at the end")
+	report := fs.String("report", "", "Write a JSON report of the steps, with the exit code and output of their commands, to this file")
 	showVersion := fs.BoolP("version", "V", false, "Show version info")
 
 	if err := fs.Parse(args); err != nil {
@@ -105,35 +126,101 @@ func parseFlags(args []string) (cliFlags, error) {
 		InputFile:  *inputFile,
 		TextOutput: *textOutput,
 		NoDryRun:   *noDryRun,
+		Explain:    *explain,
+		Strict:     *strict,
+		Now:        *now,
+		KeepGoing:  *keepGoing,
+		Report:     *report,
 	}, nil
 }
 
 // FileDescription describes a document type to match, including the grok patterns
 // to extract fields and the Go template to produce the output command.
+//
+// A description with a Threshold is scored: it matches when the weights of its
+// patterns found add up to at least Threshold, and only the best scoring one
+// among those is kept.
+//
+// Fields holds the filter chain applied to each captured field before the
+// output template is rendered. DateOrder tells how the numeric dates of the
+// description are read, and Decimal how its amounts are. Sanitize makes the
+// captures safe as file names before the output is rendered. The output
+// template is either given inline in Output or read from OutputFile, or
+// replaced by the ordered steps of Outputs. An output given as a list of
+// argument templates is in OutputArgs, and run without a shell. Exec tells
+// how the commands are run, and Hooks what to run around the outputs.
+// TemplateErrors tells what to do when an output fails to render: skip, warn
+// or fail.
 type FileDescription struct {
-	Name     string
-	Patterns []string
-	Output   string
+	Name           string
+	Patterns       []grok.Pattern
+	Merge          map[string]grok.MergePolicy
+	Threshold      float64
+	Fields         map[string]filter.Chain
+	DateOrder      dates.Order
+	Decimal        amounts.Convention
+	Sanitize       bool
+	Output         string
+	OutputFile     string
+	OutputArgs     []string
+	Outputs        []OutputStep
+	Exec           Exec
+	Hooks          Hooks
+	TemplateErrors string
 }
 
 // Config holds all configuration values for the application, merging CLI flags,
 // YAML config file, and environment variable overrides.
 type Config struct {
+	ConfigFile         string
 	InputFile          string
 	TextOutput         bool
 	NoDryRun           bool
+	Explain            bool
+	KeepGoing          bool
+	Report             string
 	GrokPatterns       map[string]string
 	FileDescriptions   []FileDescription
 	EnvVars            map[string]string
 	CommonTemplate     string
 	Months             map[string][]string
 	ExtractTextCommand []string
+	ConversionPolicy   grok.ConversionPolicy
+	CaptureConflicts   string
+	Sanitize           sanitize.Policy
+	SanitizeCaptures   bool
+	TemplateFiles      []string
+	StrictTemplates    bool
+	TemplateErrors     string
+	Location           *time.Location
+	Now                time.Time
+	Amounts            amounts.Parser
+	Exec               Exec
+	Hooks              Hooks
+	Fallback           *FileDescription
 }
 
+// FallbackName is the name of the fallback description, run when no
+// description matches.
+const FallbackName = "fallback"
+
+// Policies for the outputs that fail to render.
+const (
+	TemplateErrorsSkip = "skip"
+	TemplateErrorsWarn = "warn"
+	TemplateErrorsFail = "fail"
+)
+
 // New parses CLI flags and the YAML configuration file, returning a fully
 // populated Config. It returns ErrVersionRequested when --version is passed.
 func New(version string) (Config, error) {
-	flags, err := parseFlags(os.Args[1:])
+	return NewFromArgs(version, os.Args[1:])
+}
+
+// NewFromArgs is like New but parses the given arguments instead of the
+// command line, for subcommands.
+func NewFromArgs(version string, args []string) (Config, error) {
+	flags, err := parseFlags(args)
 	if err != nil {
 		return Config{}, err
 	}
@@ -144,9 +231,14 @@ func New(version string) (Config, error) {
 	}
 
 	var cfg Config
+	cfg.ConfigFile = flags.ConfigFile
 	cfg.InputFile = flags.InputFile
 	cfg.TextOutput = flags.TextOutput
 	cfg.NoDryRun = flags.NoDryRun
+	cfg.Explain = flags.Explain
+	cfg.StrictTemplates = flags.Strict
+	cfg.KeepGoing = flags.KeepGoing
+	cfg.Report = flags.Report
 
 	logOpts, err := cfg.readConfig(flags.ConfigFile)
 	if err != nil {
@@ -155,9 +247,40 @@ func New(version string) (Config, error) {
 
 	logger.Reset(&logOpts)
 
+	if flags.Now != "" {
+		if cfg.Now, err = ParseNow(flags.Now, cfg.Location); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := cfg.checkCaptureConflicts(); err != nil {
+		return cfg, err
+	}
+
 	return cfg, nil
 }
 
+// checkCaptureConflicts reports the fields declared by several patterns of a
+// description that have no merge policy, as a warning or as an error
+// depending on CaptureConflicts.
+func (c *Config) checkCaptureConflicts() error {
+	if c.CaptureConflicts == "ignore" {
+		return nil
+	}
+	for _, fd := range c.FileDescriptions {
+		for _, field := range grok.Conflicts(fd.Patterns) {
+			if _, ok := fd.Merge[field]; ok {
+				continue
+			}
+			if c.CaptureConflicts == "error" {
+				return fmt.Errorf("file description %s: field %q is captured by several patterns without a merge policy", fd.Name, field)
+			}
+			logger.Get().Warn("Field is captured by several patterns, the last one wins", "fileDescription", fd.Name, "field", field)
+		}
+	}
+	return nil
+}
+
 func loggerConfig(k *koanf.Koanf) logger.LogOptions {
 	logOpts := logger.LogOptions{
 		Level:      "INFO",
@@ -215,6 +338,35 @@ func lookupConfigStrings(k *koanf.Koanf, camelKey string) ([]string, bool) {
 	return nil, false
 }
 
+func lookupConfigValue(k *koanf.Koanf, camelKey string) (any, bool) {
+	envKey := strings.ToLower(camelKey)
+	if k.Exists(envKey) {
+		return k.Get(envKey), true
+	}
+	if k.Exists(camelKey) {
+		return k.Get(camelKey), true
+	}
+	return nil, false
+}
+
+// lookupConfigBool reads a boolean, given in YAML or as a string by an
+// environment variable.
+func lookupConfigBool(k *koanf.Koanf, camelKey string) (bool, bool, error) {
+	v, ok := lookupConfigValue(k, camelKey)
+	if !ok {
+		return false, false, nil
+	}
+	switch b := v.(type) {
+	case bool:
+		return b, true, nil
+	case string:
+		if parsed, err := strconv.ParseBool(b); err == nil {
+			return parsed, true, nil
+		}
+	}
+	return false, true, fmt.Errorf("%s must be a boolean, got %v", camelKey, v)
+}
+
 func lookupConfigMapKeys(k *koanf.Koanf, camelKey string) []string {
 	envKey := strings.ToLower(camelKey)
 	if k.Exists(envKey) {
@@ -278,8 +430,103 @@ func (c *Config) parseMonths(k *koanf.Koanf) {
 	}
 }
 
-func (c *Config) parseGrokPatterns(k *koanf.Koanf) error {
+// includeGrokPatternFiles loads the pattern files listed in grokPatternFiles.
+// Entries are files, directories (every file they contain) or glob patterns,
+// relative to baseDir. Later files override earlier ones.
+func (c *Config) includeGrokPatternFiles(k *koanf.Koanf, baseDir string) error {
 	c.GrokPatterns = make(map[string]string)
+	includes, _ := lookupConfigStrings(k, "grokPatternFiles")
+	for _, include := range includes {
+		files, err := expandInclude(resolvePath(baseDir, include), "grok pattern", "")
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := c.readGrokPatternFile(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandInclude returns the files of an include entry: the files of a
+// directory having the extension ext (any when empty), or the files matching a
+// glob pattern. kind names the files in errors.
+func expandInclude(include, kind, ext string) ([]string, error) {
+	if info, err := os.Stat(include); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(include)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s directory %s: %w", kind, include, err)
+		}
+		files := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if e.Type().IsRegular() && (ext == "" || filepath.Ext(e.Name()) == ext) {
+				files = append(files, filepath.Join(include, e.Name()))
+			}
+		}
+		return files, nil
+	}
+	files, err := filepath.Glob(include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s include %s: %w", kind, include, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s include %s matches no file", kind, include)
+	}
+	return files, nil
+}
+
+// TemplateExtension is the extension of the template files taken from a
+// directory listed in templates.
+const TemplateExtension = ".tmpl"
+
+// parseTemplateFiles resolves the templates entries: files, directories (their
+// .tmpl files) or glob patterns, relative to baseDir.
+func (c *Config) parseTemplateFiles(k *koanf.Koanf, baseDir string) error {
+	includes, _ := lookupConfigStrings(k, "templates")
+	for _, include := range includes {
+		files, err := expandInclude(resolvePath(baseDir, include), "template", TemplateExtension)
+		if err != nil {
+			return err
+		}
+		c.TemplateFiles = append(c.TemplateFiles, files...)
+	}
+	return nil
+}
+
+// resolvePath returns path relative to baseDir unless it is absolute.
+func resolvePath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+func (c *Config) readGrokPatternFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read grok pattern file %s: %w", filename, err)
+	}
+	defer f.Close()
+	patterns, err := grok.ReadPatterns(f)
+	if err != nil {
+		return fmt.Errorf("grok pattern file %s: %w", filename, err)
+	}
+	for k, v := range patterns {
+		c.GrokPatterns[k] = v
+	}
+	return nil
+}
+
+// DateAnyPattern is the grok pattern matching the dates written in any of the
+// forms understood by date captures, with the month names of the months lists.
+const DateAnyPattern = "DATE_ANY"
+
+func (c *Config) parseGrokPatterns(k *koanf.Koanf) error {
+	if c.GrokPatterns == nil {
+		c.GrokPatterns = make(map[string]string)
+	}
 	for _, key := range lookupConfigMapKeys(k, "grokPatterns") {
 		prefix := "grokPatterns." + key
 		if val, ok := lookupConfigString(k, prefix); ok {
@@ -292,24 +539,487 @@ func (c *Config) parseGrokPatterns(k *koanf.Koanf) error {
 		}
 		c.GrokPatterns[key] = "(" + strings.Join(months, "|") + ")"
 	}
+	if _, exists := c.GrokPatterns[DateAnyPattern]; !exists {
+		c.GrokPatterns[DateAnyPattern] = dates.Expression(c.Months)
+	}
+	return nil
+}
+
+// parsePattern converts one entry of a patterns list. An entry is either a
+// plain string or a map with a "pattern" key, or an "anyOf"/"allOf" list of
+// nested entries, plus optional/negate flags. An "engine" key selects another
+// matcher than grok; keyword engines also accept the pattern as a list.
+// "fuzzyAnchors" makes a grok pattern tolerate OCR errors.
+func parsePattern(v any) (grok.Pattern, error) {
+	switch e := v.(type) {
+	case string:
+		return grok.Pattern{Pattern: e, Weight: 1}, nil
+	case map[string]any:
+		return parsePatternMap(e)
+	default:
+		return grok.Pattern{}, fmt.Errorf("invalid pattern entry: %v", v)
+	}
+}
+
+func parsePatternMap(e map[string]any) (grok.Pattern, error) {
+	p := grok.Pattern{Weight: 1}
+	if w, ok := e["weight"]; ok {
+		weight, err := toFloat(w)
+		if err != nil {
+			return p, fmt.Errorf("weight must be a number, got %v", w)
+		}
+		p.Weight = weight
+	}
+	p.Engine, _ = e["engine"].(string)
+	p.Pattern = patternString(e["pattern"])
+	p.Optional, _ = e["optional"].(bool)
+	p.Negate, _ = e["negate"].(bool)
+	p.FindAll, _ = e["findAll"].(string)
+	if err := parsePatternGroups(&p, e); err != nil {
+		return p, err
+	}
+	if v, ok := e["fuzzyAnchors"]; ok {
+		if err := parseFuzzyAnchors(&p, v); err != nil {
+			return p, err
+		}
+	}
+	return p, validatePattern(p, e)
+}
+
+// parseFuzzyAnchors reads "fuzzyAnchors": true for OCR confusion classes
+// only, or an edit distance that the literal parts of the pattern tolerate.
+func parseFuzzyAnchors(p *grok.Pattern, v any) error {
+	switch d := v.(type) {
+	case bool:
+		p.FuzzyAnchors = d
+	case int:
+		if d < 0 {
+			return fmt.Errorf("pattern %q: fuzzyAnchors distance must not be negative", p.String())
+		}
+		p.FuzzyAnchors, p.AnchorDistance = true, d
+	default:
+		return fmt.Errorf("pattern %q: fuzzyAnchors must be a boolean or a distance, got %v", p.String(), v)
+	}
+	return nil
+}
+
+// patternString returns a pattern given as a string, or as a list of keywords
+// which the keyword engines read comma-separated, a comma within a keyword
+// being escaped.
+func patternString(v any) string {
+	if list, ok := v.([]any); ok {
+		words := make([]string, 0, len(list))
+		for _, w := range list {
+			words = append(words, fmt.Sprint(w))
+		}
+		return matcher.JoinKeywords(words)
+	}
+	s, _ := v.(string)
+	return s
+}
+
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	default:
+		return 0, fmt.Errorf("not a number: %v", v)
+	}
+}
+
+func parsePatternGroups(p *grok.Pattern, e map[string]any) error {
+	var err error
+	if v, ok := e["anyOf"]; ok {
+		if p.AnyOf, err = parsePatterns(v); err != nil {
+			return fmt.Errorf("anyOf: %w", err)
+		}
+	}
+	if v, ok := e["allOf"]; ok {
+		if p.AllOf, err = parsePatterns(v); err != nil {
+			return fmt.Errorf("allOf: %w", err)
+		}
+	}
+	return nil
+}
+
+func validatePattern(p grok.Pattern, e map[string]any) error {
+	kinds := 0
+	for _, key := range []string{"pattern", "anyOf", "allOf"} {
+		if _, ok := e[key]; ok {
+			kinds++
+		}
+	}
+	if kinds != 1 || (p.Pattern == "" && len(p.AnyOf)+len(p.AllOf) == 0) {
+		return fmt.Errorf("pattern entry needs exactly one non-empty pattern, anyOf or allOf: %v", e)
+	}
+	if p.Optional && p.Negate {
+		return fmt.Errorf("pattern %q cannot be both optional and negate", p.String())
+	}
+	for _, alt := range p.AnyOf {
+		if alt.Optional {
+			return fmt.Errorf("anyOf: pattern %q cannot be optional, an anyOf alternative is tried, not required", alt.String())
+		}
+	}
+	if p.FindAll != "" && p.Pattern == "" {
+		return fmt.Errorf("findAll %q needs a pattern, not a group", p.FindAll)
+	}
+	if p.Engine != "" && !grok.IsEngine(p.Engine) {
+		return fmt.Errorf("pattern %q: unknown engine %q", p.String(), p.Engine)
+	}
+	if p.Engine != "" && p.Pattern == "" {
+		return fmt.Errorf("engine %q needs a pattern, not a group", p.Engine)
+	}
+	if p.FuzzyAnchors && (p.Pattern == "" || (p.Engine != "" && p.Engine != grok.EngineGrok)) {
+		return fmt.Errorf("pattern %q: fuzzyAnchors is only supported by grok patterns", p.String())
+	}
+	if p.FindAll != "" && p.Engine != "" && p.Engine != grok.EngineGrok {
+		return fmt.Errorf("findAll %q is only supported by the grok engine", p.FindAll)
+	}
+	return nil
+}
+
+func parsePatterns(v any) ([]grok.Pattern, error) {
+	entries, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("patterns must be a list, got %T", v)
+	}
+	patterns := make([]grok.Pattern, 0, len(entries))
+	for _, e := range entries {
+		p, err := parsePattern(e)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func (c *Config) parseConversionPolicy(k *koanf.Koanf) error {
+	policy, _ := lookupConfigString(k, "conversionErrors")
+	switch policy {
+	case "", "nomatch":
+		c.ConversionPolicy = grok.ConversionNoMatch
+	case "error":
+		c.ConversionPolicy = grok.ConversionError
+	default:
+		return fmt.Errorf("conversionErrors must be nomatch or error, got %q", policy)
+	}
+	return nil
+}
+
+// parseSanitize reads the sanitize section: how captures are made safe as
+// file names and the destination root of safePath.
+func (c *Config) parseSanitize(k *koanf.Koanf) error {
+	c.Sanitize = sanitize.DefaultPolicy()
+	var err error
+	if c.SanitizeCaptures, _, err = lookupConfigBool(k, "sanitize.captures"); err != nil {
+		return err
+	}
+	if c.Sanitize.ASCII, _, err = lookupConfigBool(k, "sanitize.ascii"); err != nil {
+		return err
+	}
+	if v, ok := lookupConfigString(k, "sanitize.replacement"); ok {
+		if strings.ContainsAny(v, `/\`) {
+			return fmt.Errorf("sanitize.replacement must not contain a path separator, got %q", v)
+		}
+		c.Sanitize.Replacement = v
+	}
+	if v, ok := lookupConfigValue(k, "sanitize.maxLength"); ok {
+		n, err := strconv.Atoi(fmt.Sprint(v))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("sanitize.maxLength must be a positive number, got %v", v)
+		}
+		c.Sanitize.MaxLength = n
+	}
+	if v, ok := lookupConfigString(k, "sanitize.root"); ok {
+		c.Sanitize.Root = v
+	}
+	return nil
+}
+
+// isoCurrencyRegexp matches the ISO 4217 currency codes.
+var isoCurrencyRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// parseAmounts reads how amounts are read: the decimal convention, the
+// currency of the amounts written without one, and the symbols of each
+// currency besides the standard ones.
+func (c *Config) parseAmounts(k *koanf.Koanf) error {
+	c.Amounts = amounts.Parser{Currencies: make(map[string]string)}
+	if v, ok := lookupConfigString(k, "amounts.decimal"); ok {
+		var err error
+		if c.Amounts.Decimal, err = amounts.ParseConvention(v); err != nil {
+			return err
+		}
+	}
+	if v, ok := lookupConfigString(k, "amounts.currency"); ok {
+		if !isoCurrencyRegexp.MatchString(v) {
+			return fmt.Errorf("amounts.currency must be an ISO 4217 code, got %q", v)
+		}
+		c.Amounts.Currency = v
+	}
+	for _, key := range lookupConfigMapKeys(k, "amounts.currencies") {
+		code := strings.ToUpper(key)
+		if !isoCurrencyRegexp.MatchString(code) {
+			return fmt.Errorf("amounts.currencies keys must be ISO 4217 codes, got %q", key)
+		}
+		symbols, _ := lookupConfigStrings(k, "amounts.currencies."+key)
+		for _, symbol := range symbols {
+			c.Amounts.Currencies[symbol] = code
+		}
+	}
+	return nil
+}
+
+// parseTemplateErrors reads strictTemplates and the default policy for the
+// outputs that fail to render: skip, or fail in strict mode, unless set.
+func (c *Config) parseTemplateErrors(k *koanf.Koanf) error {
+	strict, _, err := lookupConfigBool(k, "strictTemplates")
+	if err != nil {
+		return err
+	}
+	c.StrictTemplates = c.StrictTemplates || strict
+	c.TemplateErrors = TemplateErrorsSkip
+	if c.StrictTemplates {
+		c.TemplateErrors = TemplateErrorsFail
+	}
+	if v, ok := lookupConfigString(k, "templateErrors"); ok {
+		if c.TemplateErrors, err = parseTemplateErrorsPolicy(v); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (c *Config) parseFileDescriptions(k *koanf.Koanf) {
+// parseTimezone reads the timezone of the template time functions, the local
+// one by default.
+func (c *Config) parseTimezone(k *koanf.Koanf) error {
+	c.Location = time.Local
+	name, ok := lookupConfigString(k, "timezone")
+	if !ok || name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	c.Location = loc
+	return nil
+}
+
+// nowLayouts are the layouts accepted by --now, in the configured timezone
+// unless the value has an offset.
+var nowLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseNow reads the value of --now.
+func ParseNow(value string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	for _, layout := range nowLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("--now must be a date such as 2006-01-02, 2006-01-02T15:04:05 or %s, got %q", time.RFC3339, value)
+}
+
+func parseTemplateErrorsPolicy(policy string) (string, error) {
+	switch policy {
+	case TemplateErrorsSkip, TemplateErrorsWarn, TemplateErrorsFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("templateErrors must be skip, warn or fail, got %q", policy)
+	}
+}
+
+func (c *Config) parseCaptureConflicts(k *koanf.Koanf) error {
+	c.CaptureConflicts, _ = lookupConfigString(k, "captureConflicts")
+	switch c.CaptureConflicts {
+	case "":
+		c.CaptureConflicts = "warn"
+	case "warn", "error", "ignore":
+	default:
+		return fmt.Errorf("captureConflicts must be warn, error or ignore, got %q", c.CaptureConflicts)
+	}
+	return nil
+}
+
+func parseMerge(k *koanf.Koanf, prefix string) (map[string]grok.MergePolicy, error) {
+	merge := make(map[string]grok.MergePolicy)
+	for _, field := range lookupConfigMapKeys(k, prefix) {
+		v, _ := lookupConfigString(k, prefix+"."+field)
+		policy, err := grok.ParseMergePolicy(v)
+		if err != nil {
+			return nil, fmt.Errorf("merge of field %s: %w", field, err)
+		}
+		merge[field] = policy
+	}
+	return merge, nil
+}
+
+// parseFields reads the filter chain of each field. A filter is either a name,
+// or a map of its name to its argument.
+func parseFields(k *koanf.Koanf, prefix string, months map[string][]string) (map[string]filter.Chain, error) {
+	fields := make(map[string]filter.Chain)
+	for _, field := range lookupConfigMapKeys(k, prefix) {
+		v, _ := lookupConfigValue(k, prefix+"."+field)
+		list, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("filters of field %s must be a list", field)
+		}
+		chain := make(filter.Chain, 0, len(list))
+		for _, e := range list {
+			f, err := parseFilter(e, months)
+			if err != nil {
+				return nil, fmt.Errorf("filters of field %s: %w", field, err)
+			}
+			chain = append(chain, f)
+		}
+		fields[field] = chain
+	}
+	return fields, nil
+}
+
+func parseFilter(v any, months map[string][]string) (filter.Filter, error) {
+	switch e := v.(type) {
+	case string:
+		return filter.New(e, nil, months)
+	case map[string]any:
+		if len(e) != 1 {
+			return nil, fmt.Errorf("filter entry needs exactly one name: %v", e)
+		}
+		for name, arg := range e {
+			return filter.New(name, arg, months)
+		}
+	}
+	return nil, fmt.Errorf("invalid filter entry: %v", v)
+}
+
+func (c *Config) parseFileDescriptions(k *koanf.Koanf) error {
 	c.FileDescriptions = make([]FileDescription, 0)
 	for _, id := range lookupConfigMapKeys(k, "fileDescriptions") {
-		prefix := "fileDescriptions." + id + "."
-		d := FileDescription{
-			Name: id,
+		d, err := c.parseFileDescription(k, id)
+		if err != nil {
+			return fmt.Errorf("file description %s: %w", id, err)
+		}
+		c.FileDescriptions = append(c.FileDescriptions, d)
+	}
+	return nil
+}
+
+// parseFallback reads the fallback description: its output and hooks, without
+// patterns.
+func (c *Config) parseFallback(k *koanf.Koanf) error {
+	if _, ok := lookupConfigValue(k, FallbackName); !ok {
+		return nil
+	}
+	if _, ok := lookupConfigValue(k, FallbackName+".patterns"); ok {
+		return errors.New("fallback: the fallback description has no patterns")
+	}
+	for _, d := range c.FileDescriptions {
+		if d.Name == FallbackName {
+			return errors.New("fallback: a file description is already named fallback")
+		}
+	}
+	d := FileDescription{Name: FallbackName, Decimal: c.Amounts.Decimal}
+	if err := c.parseOutput(k, FallbackName+".", &d); err != nil {
+		return fmt.Errorf("fallback: %w", err)
+	}
+	c.Fallback = &d
+	return nil
+}
+
+func (c *Config) parseFileDescription(k *koanf.Koanf, id string) (FileDescription, error) {
+	prefix := "fileDescriptions." + id + "."
+	d := FileDescription{
+		Name: id,
+	}
+	if v, ok := lookupConfigValue(k, prefix+"patterns"); ok {
+		patterns, err := parsePatterns(v)
+		if err != nil {
+			return d, err
+		}
+		d.Patterns = patterns
+	}
+	merge, err := parseMerge(k, prefix+"merge")
+	if err != nil {
+		return d, err
+	}
+	d.Merge = merge
+	if v, ok := lookupConfigValue(k, prefix+"threshold"); ok {
+		threshold, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil || threshold <= 0 {
+			return d, fmt.Errorf("threshold must be a positive number, got %v", v)
 		}
-		if patterns, ok := lookupConfigStrings(k, prefix+"patterns"); ok {
-			d.Patterns = patterns
+		d.Threshold = threshold
+	}
+	if d.Fields, err = parseFields(k, prefix+"fields", c.Months); err != nil {
+		return d, err
+	}
+	sanitizeCaptures, ok, err := lookupConfigBool(k, prefix+"sanitize")
+	if err != nil {
+		return d, err
+	}
+	d.Sanitize = c.SanitizeCaptures
+	if ok {
+		d.Sanitize = sanitizeCaptures
+	}
+	if order, ok := lookupConfigString(k, prefix+"dateOrder"); ok {
+		if d.DateOrder, err = dates.ParseOrder(order); err != nil {
+			return d, err
 		}
-		if output, ok := lookupConfigString(k, prefix+"output"); ok {
-			d.Output = output
+	}
+	d.Decimal = c.Amounts.Decimal
+	if decimal, ok := lookupConfigString(k, prefix+"decimal"); ok {
+		if d.Decimal, err = amounts.ParseConvention(decimal); err != nil {
+			return d, err
 		}
-		c.FileDescriptions = append(c.FileDescriptions, d)
 	}
+	return d, c.parseOutput(k, prefix, &d)
+}
+
+// parseOutput reads the output template or the output steps of a description,
+// how their commands are run and the policy for their rendering errors.
+func (c *Config) parseOutput(k *koanf.Koanf, prefix string, d *FileDescription) error {
+	var err error
+	if v, ok := lookupConfigValue(k, prefix+"output"); ok {
+		if args, ok := v.([]any); ok {
+			d.OutputArgs = argTemplates(args)
+		} else {
+			d.Output = fmt.Sprint(v)
+		}
+	}
+	if file, ok := lookupConfigString(k, prefix+"outputFile"); ok {
+		if d.Output != "" || d.OutputArgs != nil {
+			return errors.New("output and outputFile are exclusive")
+		}
+		d.OutputFile = resolvePath(filepath.Dir(c.ConfigFile), file)
+	}
+	if v, ok := lookupConfigValue(k, prefix+"outputs"); ok {
+		if d.Output != "" || d.OutputArgs != nil || d.OutputFile != "" {
+			return errors.New("outputs is exclusive with output and outputFile")
+		}
+		if d.Outputs, err = parseOutputSteps(v); err != nil {
+			return err
+		}
+	}
+	if d.Exec, err = parseExec(k, prefix+"exec", c.Exec); err != nil {
+		return err
+	}
+	if d.Hooks, err = parseHooks(k, prefix+"hooks", false); err != nil {
+		return err
+	}
+	d.TemplateErrors = c.TemplateErrors
+	if policy, ok := lookupConfigString(k, prefix+"templateErrors"); ok {
+		if d.TemplateErrors, err = parseTemplateErrorsPolicy(policy); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *Config) readConfig(filename string) (logger.LogOptions, error) {
@@ -332,10 +1042,45 @@ func (c *Config) readConfig(filename string) (logger.LogOptions, error) {
 	}
 
 	c.parseMonths(k)
+	if err := c.includeGrokPatternFiles(k, filepath.Dir(filename)); err != nil {
+		return logOpts, err
+	}
 	if err := c.parseGrokPatterns(k); err != nil {
 		return logOpts, err
 	}
-	c.parseFileDescriptions(k)
+	if err := c.parseTemplateFiles(k, filepath.Dir(filename)); err != nil {
+		return logOpts, err
+	}
+	if err := c.parseConversionPolicy(k); err != nil {
+		return logOpts, err
+	}
+	if err := c.parseCaptureConflicts(k); err != nil {
+		return logOpts, err
+	}
+	if err := c.parseSanitize(k); err != nil {
+		return logOpts, err
+	}
+	if err := c.parseTemplateErrors(k); err != nil {
+		return logOpts, err
+	}
+	if err := c.parseTimezone(k); err != nil {
+		return logOpts, err
+	}
+	if err := c.parseAmounts(k); err != nil {
+		return logOpts, err
+	}
+	if c.Exec, err = parseExec(k, "exec", DefaultExec()); err != nil {
+		return logOpts, err
+	}
+	if c.Hooks, err = parseHooks(k, "hooks", true); err != nil {
+		return logOpts, err
+	}
+	if err := c.parseFileDescriptions(k); err != nil {
+		return logOpts, err
+	}
+	if err := c.parseFallback(k); err != nil {
+		return logOpts, err
+	}
 
 	return logOpts, nil
 }
@@ -7,12 +7,17 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/knadh/koanf/v2"
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"fileganizer/amounts"
+	"fileganizer/dates"
+	"fileganizer/grok"
+	"fileganizer/sanitize"
 	"fileganizer/testutil"
 )
 
@@ -21,6 +26,7 @@ func TestVersion(t *testing.T) {
 	output := formatVersion(wantedVersion)
 	s := strings.Split(output, "\n")
 	assert.Equal(t, "Version        : "+wantedVersion, s[0], "Printing version")
+	assert.Contains(t, output, "Grok Patterns  : "+grok.LibraryVersion)
 }
 
 func TestNewVersionFlag(t *testing.T) {
@@ -97,7 +103,7 @@ fileDescriptions:
 	assert.Equal(t, "[0-9]+", cfg.GrokPatterns["NUMBER"])
 	assert.Len(t, cfg.FileDescriptions, 1)
 	assert.Equal(t, "test", cfg.FileDescriptions[0].Name)
-	assert.Equal(t, []string{"%{NUMBER:id}"}, cfg.FileDescriptions[0].Patterns)
+	assert.Equal(t, []grok.Pattern{{Pattern: "%{NUMBER:id}", Weight: 1}}, cfg.FileDescriptions[0].Patterns)
 	assert.Equal(t, "{{ .grok.id }}", cfg.FileDescriptions[0].Output)
 }
 
@@ -112,13 +118,14 @@ fileDescriptions:
     output: "{{ .grok.id }}"
 `
 	writeConfig(t, configContent)
-	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt", "-t", "-r")
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt", "-t", "-r", "--report", "report.json")
 
 	cfg, err := New("1.0")
 	require.NoError(t, err)
 
 	assert.True(t, cfg.TextOutput)
 	assert.True(t, cfg.NoDryRun)
+	assert.Equal(t, "report.json", cfg.Report)
 }
 
 func TestNewMissingExtractTextCommand(t *testing.T) {
@@ -380,3 +387,996 @@ func TestParseGrokPatterns_MonthKeyCollisionReversed(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "conflicts with existing grok pattern")
 }
+
+func TestNewWithOptionalAndNegatePatterns(t *testing.T) {
+	testutil.UseTempDir(t)
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  test:
+    patterns:
+      - "%{NUMBER:id}"
+      - pattern: "PO %{NUMBER:po}"
+        optional: true
+      - pattern: "DUPLICATA"
+        negate: true
+      - pattern: "%{NUMBER:amount} EUR"
+        findAll: lines
+    output: "{{ .grok.id }}"
+`
+	writeConfig(t, configContent)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt", "-e")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.True(t, cfg.Explain)
+	require.Len(t, cfg.FileDescriptions, 1)
+	assert.Equal(t, []grok.Pattern{
+		{Pattern: "%{NUMBER:id}", Weight: 1},
+		{Pattern: "PO %{NUMBER:po}", Optional: true, Weight: 1},
+		{Pattern: "DUPLICATA", Negate: true, Weight: 1},
+		{Pattern: "%{NUMBER:amount} EUR", FindAll: "lines", Weight: 1},
+	}, cfg.FileDescriptions[0].Patterns)
+}
+
+func TestParsePattern_Invalid(t *testing.T) {
+	_, err := parsePattern(map[string]any{"optional": true})
+	assert.ErrorContains(t, err, "needs exactly one")
+
+	_, err = parsePattern(map[string]any{"pattern": "x", "anyOf": []any{"y"}})
+	assert.ErrorContains(t, err, "needs exactly one")
+
+	_, err = parsePattern(map[string]any{"anyOf": []any{}})
+	assert.ErrorContains(t, err, "needs exactly one")
+
+	_, err = parsePattern(map[string]any{"allOf": []any{42}})
+	assert.ErrorContains(t, err, "allOf: invalid pattern entry")
+
+	_, err = parsePattern(map[string]any{"pattern": "x", "optional": true, "negate": true})
+	assert.ErrorContains(t, err, "both optional and negate")
+
+	_, err = parsePattern(map[string]any{"anyOf": []any{map[string]any{"pattern": "x", "optional": true}, "y"}})
+	assert.ErrorContains(t, err, `anyOf: pattern "x" cannot be optional`)
+
+	_, err = parsePattern(map[string]any{"anyOf": []any{"a"}, "findAll": "items"})
+	assert.ErrorContains(t, err, "needs a pattern")
+
+	_, err = parsePattern(42)
+	assert.ErrorContains(t, err, "invalid pattern entry")
+
+	_, err = parsePatterns("not a list")
+	assert.ErrorContains(t, err, "must be a list")
+}
+
+func TestNewWithPatternGroups(t *testing.T) {
+	testutil.UseTempDir(t)
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  test:
+    patterns:
+      - anyOf:
+          - "Invoice No %{NUMBER:id}"
+          - allOf:
+              - "Facture"
+              - "N° %{NUMBER:id}"
+      - anyOf: ["A", "B"]
+        optional: true
+    output: "{{ .grok.id }}"
+`
+	writeConfig(t, configContent)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	require.Len(t, cfg.FileDescriptions, 1)
+	assert.Equal(t, []grok.Pattern{
+		{AnyOf: []grok.Pattern{
+			{Pattern: "Invoice No %{NUMBER:id}", Weight: 1},
+			{AllOf: []grok.Pattern{{Pattern: "Facture", Weight: 1}, {Pattern: "N° %{NUMBER:id}", Weight: 1}}, Weight: 1},
+		}, Weight: 1},
+		{AnyOf: []grok.Pattern{{Pattern: "A", Weight: 1}, {Pattern: "B", Weight: 1}}, Optional: true, Weight: 1},
+	}, cfg.FileDescriptions[0].Patterns)
+}
+
+func TestNewWithEngines(t *testing.T) {
+	testutil.UseTempDir(t)
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  test:
+    patterns:
+      - engine: keywords
+        pattern: ["Orange", "Facture", "Paris, France"]
+      - engine: regex
+        pattern: 'N° (?P<id>\d+)'
+      - engine: anyFuzzy
+        pattern: "mobile~1, internet"
+    output: "{{ .grok.id }}"
+`
+	writeConfig(t, configContent)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	require.Len(t, cfg.FileDescriptions, 1)
+	assert.Equal(t, []grok.Pattern{
+		{Engine: grok.EngineKeywords, Pattern: `Orange, Facture, Paris\, France`, Weight: 1},
+		{Engine: grok.EngineRegex, Pattern: `N° (?P<id>\d+)`, Weight: 1},
+		{Engine: grok.EngineAnyFuzzy, Pattern: "mobile~1, internet", Weight: 1},
+	}, cfg.FileDescriptions[0].Patterns)
+}
+
+func TestParsePattern_InvalidEngine(t *testing.T) {
+	_, err := parsePattern(map[string]any{"engine": "soundex", "pattern": "x"})
+	assert.ErrorContains(t, err, `unknown engine "soundex"`)
+
+	_, err = parsePattern(map[string]any{"engine": "regex", "anyOf": []any{"x"}})
+	assert.ErrorContains(t, err, "needs a pattern, not a group")
+
+	_, err = parsePattern(map[string]any{"engine": "keywords", "pattern": "x", "findAll": "items"})
+	assert.ErrorContains(t, err, "only supported by the grok engine")
+}
+
+func TestParsePattern_FuzzyAnchors(t *testing.T) {
+	p, err := parsePattern(map[string]any{"pattern": "Invoice", "fuzzyAnchors": true})
+	require.NoError(t, err)
+	assert.Equal(t, grok.Pattern{Pattern: "Invoice", Weight: 1, FuzzyAnchors: true}, p)
+
+	p, err = parsePattern(map[string]any{"pattern": "Invoice", "fuzzyAnchors": 2})
+	require.NoError(t, err)
+	assert.Equal(t, grok.Pattern{Pattern: "Invoice", Weight: 1, FuzzyAnchors: true, AnchorDistance: 2}, p)
+
+	_, err = parsePattern(map[string]any{"pattern": "Invoice", "fuzzyAnchors": -1})
+	assert.ErrorContains(t, err, "must not be negative")
+
+	_, err = parsePattern(map[string]any{"pattern": "Invoice", "fuzzyAnchors": "yes"})
+	assert.ErrorContains(t, err, "must be a boolean or a distance")
+
+	_, err = parsePattern(map[string]any{"engine": "regex", "pattern": "Invoice", "fuzzyAnchors": true})
+	assert.ErrorContains(t, err, "only supported by grok patterns")
+
+	_, err = parsePattern(map[string]any{"anyOf": []any{"Invoice"}, "fuzzyAnchors": true})
+	assert.ErrorContains(t, err, "only supported by grok patterns")
+}
+
+func TestNewWithFieldFilters(t *testing.T) {
+	testutil.UseTempDir(t)
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+months:
+  MONTHSFRENCH: ["janvier", "février", "mars"]
+fileDescriptions:
+  test:
+    patterns:
+      - "%{NUMBER:id}"
+    fields:
+      id:
+        - trim
+        - replace: [" ", ""]
+        - truncate: 4
+      month:
+        - lower
+        - monthIndex
+      vendor:
+        - default: "unknown"
+    output: "{{ .grok.id }}"
+`
+	writeConfig(t, configContent)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	require.Len(t, cfg.FileDescriptions, 1)
+	fields := cfg.FileDescriptions[0].Fields
+	require.Len(t, fields, 3)
+
+	v, err := fields["id"].Apply(" 12 345 ")
+	require.NoError(t, err)
+	assert.Equal(t, "1234", v)
+	v, err = fields["month"].Apply("Févr.")
+	require.NoError(t, err)
+	assert.Equal(t, "02", v)
+	v, err = fields["vendor"].Apply(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown", v)
+}
+
+func TestNewWithInvalidFieldFilters(t *testing.T) {
+	tests := []struct {
+		fields string
+		want   string
+	}{
+		{"id: trim", "filters of field id must be a list"},
+		{"id: [rot13]", "unknown filter"},
+		{"id: [{replace: x}]", "replace takes a list of strings"},
+		{"id: [{trim: x, upper: y}]", "exactly one name"},
+		{"id: [42]", "invalid filter entry"},
+	}
+	for _, tt := range tests {
+		testutil.UseTempDir(t)
+		writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  test:
+    patterns: ["%{NUMBER:id}"]
+    fields:
+      `+tt.fields+`
+    output: "{{ .grok.id }}"
+`)
+		setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, tt.want, tt.fields)
+	}
+}
+
+func TestNewWithDateOrder(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+months:
+  MONTHSFRENCH: ["janvier", "février", "mars"]
+fileDescriptions:
+  us:
+    dateOrder: monthFirst
+    patterns: ["%{DATE_ANY:date:date}"]
+    output: "{{ .grok.date }}"
+  eu:
+    patterns: ["%{DATE_ANY:date:date}"]
+    output: "{{ .grok.date }}"
+`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	require.Len(t, cfg.FileDescriptions, 2)
+	orders := map[string]dates.Order{}
+	for _, fd := range cfg.FileDescriptions {
+		orders[fd.Name] = fd.DateOrder
+	}
+	assert.Equal(t, map[string]dates.Order{"us": dates.MonthFirst, "eu": dates.DayFirst}, orders)
+	assert.Equal(t, dates.Expression(cfg.Months), cfg.GrokPatterns["DATE_ANY"])
+
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+grokPatterns:
+  DATE_ANY: "%{DATE}"
+fileDescriptions:
+  test:
+    dateOrder: yearFirst
+    patterns: ["%{DATE_ANY:date:date}"]
+    output: "{{ .grok.date }}"
+`)
+	_, err = New("1.0")
+	assert.ErrorContains(t, err, "date order must be dayFirst or monthFirst")
+}
+
+func TestNewWithSanitize(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+sanitize:
+  captures: true
+  replacement: "-"
+  ascii: true
+  maxLength: 100
+  root: /archive
+fileDescriptions:
+  sanitized:
+    patterns: ["%{NUMBER:id}"]
+    output: "{{ .grok.id }}"
+  raw:
+    sanitize: false
+    patterns: ["%{NUMBER:id}"]
+    output: "{{ .grok.id }}"
+`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, sanitize.Policy{Replacement: "-", ASCII: true, MaxLength: 100, Root: "/archive"}, cfg.Sanitize)
+	require.Len(t, cfg.FileDescriptions, 2)
+	for _, fd := range cfg.FileDescriptions {
+		assert.Equal(t, fd.Name == "sanitized", fd.Sanitize, fd.Name)
+	}
+
+	t.Setenv("FILEGANIZER_SANITIZE_CAPTURES", "false")
+	cfg, err = New("1.0")
+	require.NoError(t, err)
+	assert.False(t, cfg.SanitizeCaptures)
+}
+
+func TestNewWithInvalidSanitize(t *testing.T) {
+	tests := []struct {
+		section string
+		want    string
+	}{
+		{"captures: maybe", "sanitize.captures must be a boolean"},
+		{"replacement: /", "must not contain a path separator"},
+		{"maxLength: 0", "sanitize.maxLength must be a positive number"},
+	}
+	for _, tt := range tests {
+		testutil.UseTempDir(t)
+		writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+sanitize:
+  `+tt.section+`
+`)
+		setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, tt.want, tt.section)
+	}
+}
+
+func TestNewWithTemplateErrors(t *testing.T) {
+	const descriptions = `
+fileDescriptions:
+  byDefault:
+    patterns: ["%{NUMBER:id}"]
+    output: "{{ .grok.id }}"
+  warn:
+    templateErrors: warn
+    patterns: ["%{NUMBER:id}"]
+    output: "{{ .grok.id }}"
+`
+	policies := func(cfg Config) map[string]string {
+		p := map[string]string{}
+		for _, fd := range cfg.FileDescriptions {
+			p[fd.Name] = fd.TemplateErrors
+		}
+		return p
+	}
+	testutil.UseTempDir(t)
+	writeConfig(t, `ExtractTextCommand: ["cat", "FILENAME"]`+descriptions)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.False(t, cfg.StrictTemplates)
+	assert.Equal(t, map[string]string{"byDefault": "skip", "warn": "warn"}, policies(cfg))
+
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt", "--strict")
+	cfg, err = New("1.0")
+	require.NoError(t, err)
+	assert.True(t, cfg.StrictTemplates)
+	assert.Equal(t, map[string]string{"byDefault": "fail", "warn": "warn"}, policies(cfg))
+
+	writeConfig(t, `ExtractTextCommand: ["cat", "FILENAME"]
+strictTemplates: true
+templateErrors: warn`+descriptions)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err = New("1.0")
+	require.NoError(t, err)
+	assert.True(t, cfg.StrictTemplates)
+	assert.Equal(t, map[string]string{"byDefault": "warn", "warn": "warn"}, policies(cfg))
+
+	writeConfig(t, `ExtractTextCommand: ["cat", "FILENAME"]
+templateErrors: ignore`)
+	_, err = New("1.0")
+	assert.ErrorContains(t, err, "templateErrors must be skip, warn or fail")
+}
+
+func TestNewWithTimezoneAndNow(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `ExtractTextCommand: ["cat", "FILENAME"]`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, time.Local, cfg.Location)
+	assert.True(t, cfg.Now.IsZero())
+
+	writeConfig(t, `ExtractTextCommand: ["cat", "FILENAME"]
+timezone: America/New_York`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt", "--now", "2024-01-15")
+	cfg, err = New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "America/New_York", cfg.Location.String())
+	assert.Equal(t, "2024-01-15T00:00:00-05:00", cfg.Now.Format(time.RFC3339))
+
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt", "--now", "2024-01-15T08:00:00+01:00")
+	cfg, err = New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-15T08:00:00+01:00", cfg.Now.Format(time.RFC3339))
+
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt", "--now", "yesterday")
+	_, err = New("1.0")
+	assert.ErrorContains(t, err, "--now must be a date")
+
+	writeConfig(t, `ExtractTextCommand: ["cat", "FILENAME"]
+timezone: Mars/Olympus_Mons`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	_, err = New("1.0")
+	assert.ErrorContains(t, err, "timezone:")
+}
+
+func TestNewWithOutputs(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  invoice:
+    patterns: ["%{NUMBER:id}"]
+    outputs:
+      - "echo {{ .grok.id }}"
+      - mkdir: "/archive/{{ .grok.id }}"
+        when: "{{ .grok.id }}"
+      - command: "notify {{ .grok.id }}"
+        continueOnError: true
+      - move: "/archive/{{ .grok.id }}/"
+`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	require.Len(t, cfg.FileDescriptions, 1)
+	assert.Equal(t, []OutputStep{
+		{Action: ActionCommand, Template: "echo {{ .grok.id }}"},
+		{Action: ActionMkdir, Template: "/archive/{{ .grok.id }}", When: "{{ .grok.id }}"},
+		{Action: ActionCommand, Template: "notify {{ .grok.id }}", ContinueOnError: true},
+		{Action: ActionMove, Template: "/archive/{{ .grok.id }}/"},
+	}, cfg.FileDescriptions[0].Outputs)
+
+	for content, wanted := range map[string]string{
+		`outputs: "echo"`:                                 "outputs must be a list",
+		"outputs:\n      - when: x":                       "outputs[0]: a step must be command, mkdir, move or copy",
+		"outputs:\n      - {move: a, copy: b}":            "outputs[0]: move and copy are exclusive",
+		"outputs:\n      - {copy: a, continueOnError: x}": "continueOnError must be a boolean",
+		"output: echo\n    outputs: [echo]":               "outputs is exclusive with output and outputFile",
+	} {
+		writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  invoice:
+    patterns: ["%{NUMBER:id}"]
+    `+content+"\n")
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, wanted, content)
+	}
+}
+
+func TestNewWithHooks(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+hooks:
+  onNoMatch:
+    - move: "/unsorted/"
+    - "notify {{ .filename }}"
+  afterRun: ["reindex"]
+fileDescriptions:
+  invoice:
+    patterns: ["%{NUMBER:id}"]
+    output: "echo {{ .grok.id }}"
+    hooks:
+      onMatch: ["echo {{ .grok.id }}"]
+      onError:
+        - move: "/quarantine/"
+          when: "{{ .error.exitCode }}"
+`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, Hooks{
+		OnNoMatch: []OutputStep{
+			{Action: ActionMove, Template: "/unsorted/"},
+			{Action: ActionCommand, Template: "notify {{ .filename }}"},
+		},
+		AfterRun: []OutputStep{{Action: ActionCommand, Template: "reindex"}},
+	}, cfg.Hooks)
+	require.Len(t, cfg.FileDescriptions, 1)
+	assert.Equal(t, Hooks{
+		OnMatch: []OutputStep{{Action: ActionCommand, Template: "echo {{ .grok.id }}"}},
+		OnError: []OutputStep{{Action: ActionMove, Template: "/quarantine/", When: "{{ .error.exitCode }}"}},
+	}, cfg.FileDescriptions[0].Hooks)
+	assert.Equal(t, cfg.Hooks.AfterRun, cfg.Hooks.Steps(HookAfterRun))
+
+	for content, wanted := range map[string]string{
+		"hooks:\n  onStart: [echo]": `hooks must be onMatch, onNoMatch, onError or afterRun, got "onStart"`,
+		"hooks:\n  onError: echo":   "hooks.onError: outputs must be a list",
+		"fileDescriptions:\n  invoice:\n    hooks:\n      onNoMatch: [echo]": "onNoMatch is a global hook",
+	} {
+		writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+`+content+"\n")
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, wanted, content)
+	}
+}
+
+func TestNewWithFallback(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  invoice:
+    patterns: ["%{NUMBER:id}"]
+    output: "echo {{ .grok.id }}"
+`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.Nil(t, cfg.Fallback)
+
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+exec:
+  timeout: 5s
+fileDescriptions:
+  invoice:
+    patterns: ["%{NUMBER:id}"]
+    output: "echo {{ .grok.id }}"
+fallback:
+  outputs:
+    - move: "/unsorted/"
+  hooks:
+    afterRun: ["notify {{ .file.name }}"]
+`)
+	cfg, err = New("1.0")
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Fallback)
+	assert.Equal(t, FallbackName, cfg.Fallback.Name)
+	assert.Equal(t, []OutputStep{{Action: ActionMove, Template: "/unsorted/"}}, cfg.Fallback.Outputs)
+	assert.Equal(t, []OutputStep{{Action: ActionCommand, Template: "notify {{ .file.name }}"}}, cfg.Fallback.Hooks.AfterRun)
+	assert.Equal(t, 5*time.Second, cfg.Fallback.Exec.Timeout)
+	assert.Equal(t, TemplateErrorsSkip, cfg.Fallback.TemplateErrors)
+	assert.Len(t, cfg.FileDescriptions, 1)
+
+	for content, wanted := range map[string]string{
+		"fallback:\n  patterns: [x]\n  output: echo":                   "fallback: the fallback description has no patterns",
+		"fallback:\n  output: echo\n  outputs: [echo]":                 "fallback: outputs is exclusive with output and outputFile",
+		"fallback:\n  output: echo\nfileDescriptions:\n  fallback: {}": "fallback: a file description is already named fallback",
+	} {
+		writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+`+content+"\n")
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, wanted, content)
+	}
+}
+
+func TestNewWithAmounts(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+amounts:
+  decimal: comma
+  currency: EUR
+  currencies:
+    CHF: ["Fr.", "SFr."]
+fileDescriptions:
+  french:
+    patterns: ["%{NUMBER:id}"]
+    output: "{{ .grok.id }}"
+  american:
+    decimal: point
+    patterns: ["%{NUMBER:id}"]
+    output: "{{ .grok.id }}"
+`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, amounts.Parser{
+		Decimal:    amounts.DecimalComma,
+		Currency:   "EUR",
+		Currencies: map[string]string{"Fr.": "CHF", "SFr.": "CHF"},
+	}, cfg.Amounts)
+	require.Len(t, cfg.FileDescriptions, 2)
+	for _, fd := range cfg.FileDescriptions {
+		wanted := amounts.DecimalComma
+		if fd.Name == "american" {
+			wanted = amounts.DecimalPoint
+		}
+		assert.Equal(t, wanted, fd.Decimal, fd.Name)
+	}
+
+	for content, wanted := range map[string]string{
+		"amounts:\n  decimal: dot":               "decimal must be auto, comma or point",
+		"amounts:\n  currency: euro":             "amounts.currency must be an ISO 4217 code",
+		"amounts:\n  currencies:\n    Euro: [E]": "amounts.currencies keys must be ISO 4217 codes",
+	} {
+		writeConfig(t, "ExtractTextCommand: [\"cat\", \"FILENAME\"]\n"+content+"\n")
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, wanted, content)
+	}
+}
+
+func TestNewWithExec(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+exec:
+  interpreter: python3 -c
+  dir: /tmp
+  env:
+    LANG: C
+fileDescriptions:
+  byDefault:
+    patterns: ["%{NUMBER:id}"]
+    output: "print({{ .grok.id }})"
+  list:
+    patterns: ["%{NUMBER:id}"]
+    output: ["mv", "{{ .filename }}", "/archive/{{ .grok.id }}.pdf"]
+  argv:
+    exec: argv
+    patterns: ["%{NUMBER:id}"]
+    output: '["echo", "{{ .grok.id }}"]'
+  own:
+    exec:
+      interpreter: [sh, -c]
+      env:
+        TZ: UTC
+    patterns: ["%{NUMBER:id}"]
+    outputs:
+      - [echo, "{{ .grok.id }}"]
+      - command: [touch, "{{ .grok.id }}"]
+`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	global := Exec{Mode: ExecShell, Interpreter: []string{"python3", "-c"}, Dir: "/tmp", Env: map[string]string{"LANG": "C"}}
+	assert.Equal(t, global, cfg.Exec)
+	byName := map[string]FileDescription{}
+	for _, fd := range cfg.FileDescriptions {
+		byName[fd.Name] = fd
+	}
+	assert.Equal(t, global, byName["byDefault"].Exec)
+	assert.Equal(t, "print({{ .grok.id }})", byName["byDefault"].Output)
+	assert.Equal(t, []string{"mv", "{{ .filename }}", "/archive/{{ .grok.id }}.pdf"}, byName["list"].OutputArgs)
+	assert.Empty(t, byName["list"].Output)
+	assert.Equal(t, ExecArgv, byName["argv"].Exec.Mode)
+	assert.Equal(t, Exec{Mode: ExecShell, Interpreter: []string{"sh", "-c"}, Dir: "/tmp", Env: map[string]string{"LANG": "C", "TZ": "UTC"}},
+		byName["own"].Exec)
+	assert.Equal(t, []OutputStep{
+		{Action: ActionCommand, Args: []string{"echo", "{{ .grok.id }}"}},
+		{Action: ActionCommand, Args: []string{"touch", "{{ .grok.id }}"}},
+	}, byName["own"].Outputs)
+
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+exec:
+  inheritEnv: [PATH, HOME]
+  timeout: 1m
+fileDescriptions:
+  own:
+    exec:
+      inheritEnv: []
+      exportCaptures: true
+      timeout: 5s
+    patterns: ["%{NUMBER:id}"]
+    output: "echo"
+`)
+	cfg, err = New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PATH", "HOME"}, cfg.Exec.InheritEnv)
+	assert.Equal(t, time.Minute, cfg.Exec.Timeout)
+	assert.False(t, cfg.Exec.ExportCaptures)
+	require.Len(t, cfg.FileDescriptions, 1)
+	own := cfg.FileDescriptions[0].Exec
+	assert.Equal(t, []string{}, own.InheritEnv)
+	assert.True(t, own.ExportCaptures)
+	assert.Equal(t, 5*time.Second, own.Timeout)
+
+	for content, wanted := range map[string]string{
+		"exec:\n  timeout: 10":           "exec timeout must be a duration",
+		"exec:\n  exportCaptures: maybe": "exportCaptures must be a boolean",
+		"exec: pipe":                     "exec mode must be shell or argv",
+		"exec:\n  interpreter: \"\"":     "exec interpreter must be a command",
+		"exec:\n  interpreter: python3":  "needs the argument that introduces the command",
+	} {
+		writeConfig(t, "ExtractTextCommand: [\"cat\", \"FILENAME\"]\n"+content+"\n")
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, wanted, content)
+	}
+}
+
+func TestParseInterpreter(t *testing.T) {
+	for v, wanted := range map[any][]string{
+		"sh":          {"sh", "-c"},
+		"/bin/bash":   {"/bin/bash", "-c"},
+		"python3 -c":  {"python3", "-c"},
+		"bash -eu -c": {"bash", "-eu", "-c"},
+	} {
+		interpreter, err := parseInterpreter(v)
+		require.NoError(t, err, v)
+		assert.Equal(t, wanted, interpreter, v)
+	}
+	interpreter, err := parseInterpreter([]any{"zsh"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zsh", "-c"}, interpreter)
+	_, err = parseInterpreter("node")
+	assert.ErrorContains(t, err, "exec interpreter node needs the argument")
+}
+
+func TestParseConversionPolicy(t *testing.T) {
+	k := koanf.New(".")
+	c := &Config{}
+	require.NoError(t, c.parseConversionPolicy(k))
+	assert.Equal(t, grok.ConversionNoMatch, c.ConversionPolicy)
+
+	require.NoError(t, k.Set("conversionErrors", "error"))
+	require.NoError(t, c.parseConversionPolicy(k))
+	assert.Equal(t, grok.ConversionError, c.ConversionPolicy)
+
+	require.NoError(t, k.Set("conversionErrors", "bogus"))
+	assert.ErrorContains(t, c.parseConversionPolicy(k), "conversionErrors")
+}
+
+func TestNewWithGrokPatternFiles(t *testing.T) {
+	testutil.UseTempDir(t)
+	require.NoError(t, os.MkdirAll("conf/patterns.d", 0o700))
+	require.NoError(t, os.WriteFile("conf/patterns.d/a.grok", []byte("# vendor A\nVENDORA ACME\nREF A-%{NUMBER}\n"), 0o600))
+	require.NoError(t, os.WriteFile("conf/patterns.d/b.grok", []byte("VENDORB Globex\n"), 0o600))
+	require.NoError(t, os.WriteFile("conf/extra.grok", []byte("REF B-%{NUMBER}\nCUSTOMER C-%{NUMBER}\n"), 0o600))
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+grokPatternFiles:
+  - patterns.d
+  - "*.grok"
+grokPatterns:
+  CUSTOMER: 'K-%{NUMBER}'
+`
+	require.NoError(t, os.WriteFile("conf/config.yaml", []byte(configContent), 0o600))
+	setArgs(t, "fileganizer", "-c", "conf/config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"VENDORA":  "ACME",
+		"VENDORB":  "Globex",
+		"REF":      "B-%{NUMBER}",
+		"CUSTOMER": "K-%{NUMBER}",
+		"DATE_ANY": dates.Expression(nil),
+	}, cfg.GrokPatterns)
+}
+
+func TestNewWithTemplates(t *testing.T) {
+	testutil.UseTempDir(t)
+	require.NoError(t, os.MkdirAll("conf/templates.d", 0o700))
+	require.NoError(t, os.WriteFile("conf/templates.d/a.tmpl", []byte(`{{ define "a" }}a{{ end }}`), 0o600))
+	require.NoError(t, os.WriteFile("conf/templates.d/notes.txt", []byte("not a template"), 0o600))
+	require.NoError(t, os.WriteFile("conf/b.tmpl", []byte(`{{ define "b" }}b{{ end }}`), 0o600))
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+templates:
+  - templates.d
+  - "*.tmpl"
+fileDescriptions:
+  test:
+    patterns: ["%{NUMBER:id}"]
+    outputFile: b.tmpl
+`
+	require.NoError(t, os.WriteFile("conf/config.yaml", []byte(configContent), 0o600))
+	setArgs(t, "fileganizer", "-c", "conf/config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"conf/templates.d/a.tmpl", "conf/b.tmpl"}, cfg.TemplateFiles)
+	require.Len(t, cfg.FileDescriptions, 1)
+	assert.Equal(t, "conf/b.tmpl", cfg.FileDescriptions[0].OutputFile)
+}
+
+func TestNewWithInvalidTemplates(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+templates: ["missing/*.tmpl"]
+`)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	_, err := New("1.0")
+	assert.ErrorContains(t, err, "template include")
+
+	writeConfig(t, `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  test:
+    patterns: ["%{NUMBER:id}"]
+    output: "{{ .grok.id }}"
+    outputFile: test.tmpl
+`)
+	_, err = New("1.0")
+	assert.ErrorContains(t, err, "output and outputFile are exclusive")
+}
+
+func TestNewWithMissingGrokPatternFile(t *testing.T) {
+	testutil.UseTempDir(t)
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+grokPatternFiles: ["missing.grok"]
+`
+	writeConfig(t, configContent)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	_, err := New("1.0")
+	assert.ErrorContains(t, err, "matches no file")
+}
+
+func TestNewWithBrokenGrokPatternFile(t *testing.T) {
+	testutil.UseTempDir(t)
+	require.NoError(t, os.WriteFile("broken.grok", []byte("NOEXPRESSION\n"), 0o600))
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+grokPatternFiles: ["broken.grok"]
+`
+	writeConfig(t, configContent)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	_, err := New("1.0")
+	assert.ErrorContains(t, err, "broken.grok: line 1")
+}
+
+func TestNewWithMergePolicies(t *testing.T) {
+	testutil.UseTempDir(t)
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+captureConflicts: error
+fileDescriptions:
+  test:
+    patterns:
+      - "No %{NUMBER:id}"
+      - "Ref %{NUMBER:id}"
+    merge:
+      id: must-equal
+    output: "{{ .grok.id }}"
+`
+	writeConfig(t, configContent)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "error", cfg.CaptureConflicts)
+	assert.Equal(t, map[string]grok.MergePolicy{"id": grok.MergeMustEqual}, cfg.FileDescriptions[0].Merge)
+}
+
+func TestNewWithCaptureConflicts(t *testing.T) {
+	const base = `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  test:
+    patterns:
+      - "No %{NUMBER:id}"
+      - "Ref %{NUMBER:id}"
+    output: "{{ .grok.id }}"
+`
+	t.Run("warn by default", func(t *testing.T) {
+		testutil.UseTempDir(t)
+		writeConfig(t, base)
+		setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+		cfg, err := New("1.0")
+		require.NoError(t, err)
+		assert.Equal(t, "warn", cfg.CaptureConflicts)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		testutil.UseTempDir(t)
+		writeConfig(t, "captureConflicts: error\n"+base)
+		setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, `field "id" is captured by several patterns`)
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		testutil.UseTempDir(t)
+		writeConfig(t, "captureConflicts: maybe\n"+base)
+		setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, "captureConflicts must be")
+	})
+
+	t.Run("invalid merge", func(t *testing.T) {
+		testutil.UseTempDir(t)
+		writeConfig(t, base+"    merge:\n      id: sometimes\n")
+		setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+		_, err := New("1.0")
+		assert.ErrorContains(t, err, "merge of field id")
+	})
+}
+
+func TestNewWithWeightsAndThreshold(t *testing.T) {
+	testutil.UseTempDir(t)
+	configContent := `
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  test:
+    threshold: 2.5
+    patterns:
+      - pattern: "Orange"
+        weight: 2
+      - pattern: "Facture"
+        weight: 0.5
+      - "Mobile"
+    output: "{{ .score }}"
+`
+	writeConfig(t, configContent)
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	fd := cfg.FileDescriptions[0]
+	assert.InDelta(t, 2.5, fd.Threshold, 1e-9)
+	assert.InDelta(t, 2, fd.Patterns[0].Weight, 1e-9)
+	assert.InDelta(t, 0.5, fd.Patterns[1].Weight, 1e-9)
+	assert.InDelta(t, 1, fd.Patterns[2].Weight, 1e-9)
+}
+
+func TestNewWithInvalidThresholdOrWeight(t *testing.T) {
+	for name, content := range map[string]string{
+		"threshold must be a positive number": "    threshold: -1\n    patterns: [\"a\"]\n",
+		"weight must be a number":             "    patterns:\n      - pattern: a\n        weight: heavy\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			testutil.UseTempDir(t)
+			writeConfig(t, "ExtractTextCommand: [\"cat\", \"FILENAME\"]\nfileDescriptions:\n  test:\n"+content)
+			setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+			_, err := New("1.0")
+			assert.ErrorContains(t, err, name)
+		})
+	}
+}
+
+func TestAppendPattern(t *testing.T) {
+	testutil.UseTempDir(t)
+	writeConfig(t, `---
+# invoices
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  invoice:
+    patterns:
+      - "Invoice"
+      - pattern: "DUPLICATA"
+        negate: true
+
+    output: |
+      mv {{ .filename }} invoices/
+  receipt:
+    patterns: ["Receipt"]
+`)
+
+	require.NoError(t, AppendPattern("test_config.yaml", "invoice", `No %{NUMBER:id}\n`))
+	require.NoError(t, AppendPattern("test_config.yaml", "order", "Order"))
+	content, err := os.ReadFile("test_config.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, `---
+# invoices
+ExtractTextCommand: ["cat", "FILENAME"]
+fileDescriptions:
+  invoice:
+    patterns:
+      - "Invoice"
+      - pattern: "DUPLICATA"
+        negate: true
+      - "No %{NUMBER:id}\\n"
+
+    output: |
+      mv {{ .filename }} invoices/
+  receipt:
+    patterns: ["Receipt"]
+  order:
+    patterns:
+      - "Order"
+`, string(content))
+
+	require.NoError(t, AppendPattern("test_config.yaml", "receipt", "Total"))
+	setArgs(t, "fileganizer", "-c", "test_config.yaml", "-f", "input.txt")
+	cfg, err := New("1.0")
+	require.NoError(t, err)
+	require.Len(t, cfg.FileDescriptions, 3)
+	assert.Equal(t, "invoice", cfg.FileDescriptions[0].Name)
+	assert.Equal(t, grok.Pattern{Pattern: `No %{NUMBER:id}\n`, Weight: 1}, cfg.FileDescriptions[0].Patterns[2])
+	assert.Equal(t, []grok.Pattern{{Pattern: "Order", Weight: 1}}, cfg.FileDescriptions[1].Patterns)
+	assert.Equal(t, []grok.Pattern{{Pattern: "Receipt", Weight: 1}, {Pattern: "Total", Weight: 1}}, cfg.FileDescriptions[2].Patterns)
+	content, err = os.ReadFile("test_config.yaml")
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "# invoices\n", "comments are kept when the file is rewritten")
+}
+
+func TestAppendPattern_Invalid(t *testing.T) {
+	testutil.UseTempDir(t)
+
+	assert.Error(t, AppendPattern("missing.yaml", "invoice", "Invoice"))
+
+	writeConfig(t, "- a list\n")
+	assert.ErrorContains(t, AppendPattern("test_config.yaml", "invoice", "Invoice"), "not a YAML mapping")
+
+	writeConfig(t, "fileDescriptions:\n  invoice:\n    patterns: Invoice\n")
+	assert.ErrorContains(t, AppendPattern("test_config.yaml", "invoice", "Invoice"), "unexpected type")
+}
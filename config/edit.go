@@ -0,0 +1,177 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// yamlIndent is the indentation used when the configuration file is rewritten.
+const yamlIndent = 2
+
+// AppendPattern adds a pattern at the end of the patterns of a file
+// description in the YAML configuration file, creating the description when it
+// does not exist. The pattern is inserted as new lines, leaving the rest of the
+// file as is; only when the file has no block list to insert into is it
+// rewritten, keeping its comments.
+func AppendPattern(filename, description, pattern string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: the configuration is not a YAML mapping", filename)
+	}
+	item := patternNode(pattern)
+	quoted, err := QuotePattern(pattern)
+	if err != nil {
+		return err
+	}
+	updated, ok := insertPattern(content, doc.Content[0], description, quoted)
+	if !ok {
+		if updated, err = appendPatternNode(&doc, description, item); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, updated, info.Mode().Perm())
+}
+
+// QuotePattern returns a pattern as a double-quoted YAML string, ready to be
+// pasted in a patterns list.
+func QuotePattern(pattern string) (string, error) {
+	value, err := yaml.Marshal(patternNode(pattern))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(value), "\n"), nil
+}
+
+func patternNode(pattern string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: pattern, Style: yaml.DoubleQuotedStyle}
+}
+
+// insertPattern inserts the quoted pattern as new lines, after the last
+// pattern of the description or as a new description after the last one. It
+// reports false when the file does not have the block layout this needs.
+func insertPattern(content []byte, root *yaml.Node, description, quoted string) ([]byte, bool) {
+	descriptions := lookupNode(root, "fileDescriptions")
+	if !isBlock(descriptions, yaml.MappingNode) {
+		return nil, false
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	fd := lookupNode(descriptions, description)
+	if fd == nil {
+		indent := strings.Repeat(" ", descriptions.Content[0].Column-1)
+		return insertLines(lines, lastLine(descriptions), []string{
+			indent + description + ":",
+			indent + "  patterns:",
+			indent + "    - " + quoted,
+		}), true
+	}
+	patterns := lookupNode(fd, "patterns")
+	if !isBlock(patterns, yaml.SequenceNode) {
+		return nil, false
+	}
+	first := lines[patterns.Content[0].Line-1]
+	indent := first[:strings.IndexByte(first, '-')]
+	return insertLines(lines, lastLine(patterns), []string{indent + "- " + quoted}), true
+}
+
+// appendPatternNode adds the pattern to the document and encodes it again.
+func appendPatternNode(doc *yaml.Node, description string, item *yaml.Node) ([]byte, error) {
+	descriptions, err := mappingValue(doc.Content[0], "fileDescriptions", yaml.MappingNode)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := mappingValue(descriptions, description, yaml.MappingNode)
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := mappingValue(fd, "patterns", yaml.SequenceNode)
+	if err != nil {
+		return nil, fmt.Errorf("file description %s: %w", description, err)
+	}
+	patterns.Content = append(patterns.Content, item)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(yamlIndent)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// insertLines inserts the new lines after line number at (1-based).
+func insertLines(lines []string, at int, newLines []string) []byte {
+	at = min(at, len(lines))
+	if !strings.HasSuffix(lines[at-1], "\n") {
+		lines[at-1] += "\n"
+	}
+	inserted := make([]string, 0, len(lines)+len(newLines))
+	inserted = append(inserted, lines[:at]...)
+	for _, l := range newLines {
+		inserted = append(inserted, l+"\n")
+	}
+	return []byte(strings.Join(append(inserted, lines[at:]...), ""))
+}
+
+// lastLine returns the number of the last line taken by a node.
+func lastLine(n *yaml.Node) int {
+	last := n.Line
+	if n.Kind == yaml.ScalarNode && n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		last += strings.Count(strings.TrimSuffix(n.Value, "\n"), "\n") + 1
+	}
+	for _, c := range n.Content {
+		last = max(last, lastLine(c))
+	}
+	return last
+}
+
+func isBlock(n *yaml.Node, kind yaml.Kind) bool {
+	return n != nil && n.Kind == kind && n.Style&yaml.FlowStyle == 0 && len(n.Content) > 0
+}
+
+// lookupNode returns the value of key in a mapping node, or nil.
+func lookupNode(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, adding an empty
+// node of the given kind when the key is missing.
+func mappingValue(m *yaml.Node, key string, kind yaml.Kind) (*yaml.Node, error) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != key {
+			continue
+		}
+		v := m.Content[i+1]
+		if v.Kind != kind {
+			return nil, fmt.Errorf("%s has an unexpected type", key)
+		}
+		return v, nil
+	}
+	v := &yaml.Node{Kind: kind}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	return v, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+)
+
+// Modes of execution of the output commands.
+const (
+	ExecShell = "shell"
+	ExecArgv  = "argv"
+)
+
+// DefaultInterpreter runs the output commands in shell mode.
+var DefaultInterpreter = []string{"bash", "-c"}
+
+// Exec tells how the commands of the outputs are run. In shell mode, the
+// rendered command is the last argument of Interpreter. In argv mode, it is a
+// YAML or JSON list of arguments, run without a shell. Dir is the working
+// directory of the command, the current one when empty.
+//
+// The command inherits the variables of the environment named in InheritEnv,
+// all of them when it is nil, then gets the captures as FG_GROK_* variables
+// when ExportCaptures is set, then the variables of Env. A step that lasts
+// more than Timeout, when set, is stopped and fails.
+type Exec struct {
+	Mode           string
+	Interpreter    []string
+	Dir            string
+	Env            map[string]string
+	InheritEnv     []string
+	ExportCaptures bool
+	Timeout        time.Duration
+}
+
+// DefaultExec returns the settings used when the configuration sets nothing.
+func DefaultExec() Exec {
+	return Exec{Mode: ExecShell, Interpreter: slices.Clone(DefaultInterpreter), Env: map[string]string{}}
+}
+
+// parseExec reads an exec section over base: either a mode, or a map of
+// mode, interpreter, dir, env, inheritEnv, exportCaptures and timeout. The
+// variables of env are added to the ones of base.
+func parseExec(k *koanf.Koanf, key string, base Exec) (Exec, error) {
+	x := base
+	x.Interpreter = slices.Clone(base.Interpreter)
+	x.Env = maps.Clone(base.Env)
+	x.InheritEnv = slices.Clone(base.InheritEnv)
+	v, ok := lookupConfigValue(k, key)
+	if !ok {
+		return x, nil
+	}
+	if mode, ok := v.(string); ok {
+		return x, x.setMode(mode)
+	}
+	if mode, ok := lookupConfigString(k, key+".mode"); ok {
+		if err := x.setMode(mode); err != nil {
+			return x, err
+		}
+	}
+	if v, ok := lookupConfigValue(k, key+".interpreter"); ok {
+		interpreter, err := parseInterpreter(v)
+		if err != nil {
+			return x, err
+		}
+		x.Interpreter = interpreter
+	}
+	if dir, ok := lookupConfigString(k, key+".dir"); ok {
+		x.Dir = dir
+	}
+	if v, ok := lookupConfigString(k, key+".timeout"); ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			return x, fmt.Errorf("exec timeout must be a duration such as 30s, got %q", v)
+		}
+		x.Timeout = timeout
+	}
+	return x, x.parseEnv(k, key)
+}
+
+// parseEnv reads the keys of an exec section about the environment of the
+// command.
+func (x *Exec) parseEnv(k *koanf.Koanf, key string) error {
+	if x.Env == nil {
+		x.Env = make(map[string]string)
+	}
+	for _, name := range lookupConfigMapKeys(k, key+".env") {
+		value, _ := lookupConfigString(k, key+".env."+name)
+		x.Env[name] = value
+	}
+	if names, ok := lookupConfigStrings(k, key+".inheritEnv"); ok {
+		x.InheritEnv = append([]string{}, names...)
+	}
+	export, ok, err := lookupConfigBool(k, key+".exportCaptures")
+	if ok {
+		x.ExportCaptures = export
+	}
+	return err
+}
+
+func (x *Exec) setMode(mode string) error {
+	switch mode {
+	case ExecShell, ExecArgv:
+		x.Mode = mode
+		return nil
+	default:
+		return fmt.Errorf("exec mode must be shell or argv, got %q", mode)
+	}
+}
+
+// shells take the command to run after -c, which is added when one of them is
+// given as the interpreter without arguments.
+var shells = []string{"sh", "bash", "dash", "ash", "ksh", "mksh", "zsh"}
+
+// parseInterpreter reads an interpreter given as a command line, "python3 -c",
+// or as a list of arguments. A shell alone gets -c; any other interpreter must
+// have the argument that introduces the command.
+func parseInterpreter(v any) ([]string, error) {
+	var interpreter []string
+	switch e := v.(type) {
+	case string:
+		interpreter = strings.Fields(e)
+	case []any:
+		for _, arg := range e {
+			interpreter = append(interpreter, fmt.Sprint(arg))
+		}
+	}
+	if len(interpreter) == 0 {
+		return nil, fmt.Errorf("exec interpreter must be a command, got %v", v)
+	}
+	if len(interpreter) == 1 {
+		if !slices.Contains(shells, filepath.Base(interpreter[0])) {
+			return nil, fmt.Errorf("exec interpreter %s needs the argument that introduces the command, as in python3 -c",
+				interpreter[0])
+		}
+		interpreter = append(interpreter, "-c")
+	}
+	return interpreter, nil
+}
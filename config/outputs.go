@@ -0,0 +1,172 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/knadh/koanf/v2"
+)
+
+// Actions of an output step.
+const (
+	ActionCommand = "command"
+	ActionMkdir   = "mkdir"
+	ActionMove    = "move"
+	ActionCopy    = "copy"
+)
+
+// outputActions are the actions of an output step, in the order they are
+// looked for.
+var outputActions = []string{ActionCommand, ActionMkdir, ActionMove, ActionCopy}
+
+// OutputStep is one of the ordered outputs of a description. Template renders
+// the shell command of a command step, or the path of a native action: the
+// directory to create, or the destination of the input file for move and
+// copy. A command given as a list of argument templates is in Args instead,
+// and run without a shell. The step runs only when its When template, if any, renders a true
+// value. A step that fails stops the outputs of the description unless
+// ContinueOnError is set.
+type OutputStep struct {
+	Action          string
+	Template        string
+	Args            []string
+	When            string
+	ContinueOnError bool
+}
+
+// parseOutputSteps reads the outputs list of a description. A step is either
+// a command template or a map with one action key and optional when and
+// continueOnError keys.
+func parseOutputSteps(v any) ([]OutputStep, error) {
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("outputs must be a list, got %T", v)
+	}
+	steps := make([]OutputStep, 0, len(list))
+	for i, item := range list {
+		step, err := parseOutputStep(item)
+		if err != nil {
+			return nil, fmt.Errorf("outputs[%d]: %w", i, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func parseOutputStep(v any) (OutputStep, error) {
+	switch e := v.(type) {
+	case string:
+		return OutputStep{Action: ActionCommand, Template: e}, nil
+	case map[string]any:
+		var step OutputStep
+		for _, action := range outputActions {
+			tpl, ok := e[action]
+			if !ok {
+				continue
+			}
+			if step.Action != "" {
+				return step, fmt.Errorf("%s and %s are exclusive", step.Action, action)
+			}
+			step.Action = action
+			if args, ok := tpl.([]any); ok && action == ActionCommand {
+				step.Args = argTemplates(args)
+			} else {
+				step.Template = fmt.Sprint(tpl)
+			}
+		}
+		if step.Action == "" {
+			return step, errors.New("a step must be command, mkdir, move or copy")
+		}
+		if when, ok := e["when"]; ok {
+			step.When = fmt.Sprint(when)
+		}
+		if c, ok := e["continueOnError"]; ok {
+			b, err := strconv.ParseBool(fmt.Sprint(c))
+			if err != nil {
+				return step, fmt.Errorf("continueOnError must be a boolean, got %v", c)
+			}
+			step.ContinueOnError = b
+		}
+		return step, nil
+	case []any:
+		return OutputStep{Action: ActionCommand, Args: argTemplates(e)}, nil
+	default:
+		return OutputStep{}, fmt.Errorf("a step must be a command or a map, got %T", v)
+	}
+}
+
+// argTemplates returns the templates of the arguments of a command given as
+// a list.
+func argTemplates(list []any) []string {
+	args := make([]string, 0, len(list))
+	for _, arg := range list {
+		args = append(args, fmt.Sprint(arg))
+	}
+	return args
+}
+
+// Hook events.
+const (
+	HookOnMatch   = "onMatch"
+	HookOnNoMatch = "onNoMatch"
+	HookOnError   = "onError"
+	HookAfterRun  = "afterRun"
+)
+
+// Hooks are steps run on the events of a run, like outputs. OnMatch steps run
+// before the outputs of a matching description, OnNoMatch ones when no
+// description matches, OnError ones when outputs fail and AfterRun ones after
+// they succeeded.
+type Hooks struct {
+	OnMatch   []OutputStep
+	OnNoMatch []OutputStep
+	OnError   []OutputStep
+	AfterRun  []OutputStep
+}
+
+// parseHooks reads a hooks section. A description has no onNoMatch hook.
+func parseHooks(k *koanf.Koanf, key string, global bool) (Hooks, error) {
+	var h Hooks
+	for _, event := range lookupConfigMapKeys(k, key) {
+		v, _ := lookupConfigValue(k, key+"."+event)
+		steps, err := parseOutputSteps(v)
+		if err != nil {
+			return h, fmt.Errorf("hooks.%s: %w", event, err)
+		}
+		switch {
+		case event == HookOnMatch:
+			h.OnMatch = steps
+		case event == HookOnNoMatch && global:
+			h.OnNoMatch = steps
+		case event == HookOnError:
+			h.OnError = steps
+		case event == HookAfterRun:
+			h.AfterRun = steps
+		case event == HookOnNoMatch:
+			return h, errors.New("onNoMatch is a global hook")
+		default:
+			return h, fmt.Errorf("hooks must be onMatch, onNoMatch, onError or afterRun, got %q", event)
+		}
+	}
+	return h, nil
+}
+
+// Steps returns the steps of an event.
+func (h Hooks) Steps(event string) []OutputStep {
+	switch event {
+	case HookOnMatch:
+		return h.OnMatch
+	case HookOnNoMatch:
+		return h.OnNoMatch
+	case HookOnError:
+		return h.OnError
+	case HookAfterRun:
+		return h.AfterRun
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+// Package dates parses the dates written in documents, numeric or with month
+// names taken from the configured months lists.
+package dates
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fileganizer/accents"
+)
+
+// Order tells how an all-numeric date such as 03/04/2014 is read.
+type Order int
+
+const (
+	// DayFirst reads 03/04/2014 as the 3rd of April.
+	DayFirst Order = iota
+	// MonthFirst reads 03/04/2014 as March 4th.
+	MonthFirst
+)
+
+// ParseOrder converts the name of an order, "dayFirst" or "monthFirst".
+func ParseOrder(name string) (Order, error) {
+	switch name {
+	case "dayFirst":
+		return DayFirst, nil
+	case "monthFirst":
+		return MonthFirst, nil
+	default:
+		return DayFirst, fmt.Errorf("date order must be dayFirst or monthFirst, got %q", name)
+	}
+}
+
+// MinMonthPrefix is the number of letters an abbreviated month name must have
+// to be recognized.
+const MinMonthPrefix = 3
+
+// Parser parses dates with the month names of the configured months lists.
+// The zero value only understands numeric dates, day first.
+type Parser struct {
+	Months map[string][]string
+	Order  Order
+}
+
+var (
+	tokenRegexp   = regexp.MustCompile(`\p{L}+|\d+`)
+	ordinalSuffix = map[string]bool{"er": true, "st": true, "nd": true, "rd": true, "th": true}
+)
+
+// dateTokenCount is the number of parts of a date: day, month and year.
+const dateTokenCount = 3
+
+// Parse reads a date such as "27 mars 2014", "March 27, 2014", "27/03/14" or
+// "2014-03-27". Month names are compared ignoring case and accents, and may be
+// abbreviated as long as they are the start of a single month. Two-digit years
+// from 69 to 99 are in the 1900s, the others in the 2000s.
+func (p Parser) Parse(s string) (time.Time, error) {
+	var numbers []string
+	var month string
+	afterNumber := false
+	for _, t := range tokenRegexp.FindAllString(s, -1) {
+		number := t[0] >= '0' && t[0] <= '9'
+		switch {
+		case number:
+			numbers = append(numbers, t)
+		case afterNumber && ordinalSuffix[strings.ToLower(t)]:
+		case month == "":
+			month = t
+		default:
+			return time.Time{}, fmt.Errorf("no date in %q", s)
+		}
+		afterNumber = number
+	}
+	if month != "" {
+		numbers = append(numbers, month)
+	}
+	if len(numbers) != dateTokenCount {
+		return time.Time{}, fmt.Errorf("no date in %q", s)
+	}
+	y, m, d, err := p.fields(numbers, month != "")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q: %w", s, err)
+	}
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if t.Day() != d || int(t.Month()) != m {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	return t, nil
+}
+
+// fields returns the year, month and day of the tokens of a date. With a
+// month name, the name comes last and the two numbers are the day and the
+// year, in any order when the year has four digits.
+func (p Parser) fields(tokens []string, named bool) (int, int, int, error) {
+	var year, month, day string
+	switch {
+	case named:
+		day, year = tokens[0], tokens[1]
+		if len(day) == 4 { //nolint:mnd
+			day, year = year, day
+		}
+		m, err := p.monthIndex(tokens[2])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		month = strconv.Itoa(m)
+	case len(tokens[0]) == 4: //nolint:mnd
+		year, month, day = tokens[0], tokens[1], tokens[2]
+	case p.Order == MonthFirst:
+		month, day, year = tokens[0], tokens[1], tokens[2]
+	default:
+		day, month, year = tokens[0], tokens[1], tokens[2]
+	}
+	y, err := parseYear(year)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	m, _ := strconv.Atoi(month)
+	d, _ := strconv.Atoi(day)
+	return y, m, d, nil
+}
+
+func parseYear(s string) (int, error) {
+	y, err := strconv.Atoi(s)
+	switch {
+	case err != nil:
+		return 0, err
+	case len(s) == 2: //nolint:mnd
+		if y >= 69 { //nolint:mnd
+			return 1900 + y, nil //nolint:mnd
+		}
+		return 2000 + y, nil //nolint:mnd
+	case len(s) == 4: //nolint:mnd
+		return y, nil
+	default:
+		return 0, fmt.Errorf("invalid year %q", s)
+	}
+}
+
+// monthIndex returns the number of a month name from the months lists.
+func (p Parser) monthIndex(name string) (int, error) {
+	return MonthIndex(name, p.Months)
+}
+
+// MonthIndex returns the number, from 1, of a month name from the months
+// lists, comparing names ignoring case and accents. Abbreviations such as
+// "févr." are accepted when they are the start of a single month name.
+func MonthIndex(name string, months map[string][]string) (int, error) {
+	folded := fold(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	abbreviated := make(map[int]struct{})
+	for _, list := range months {
+		for i, m := range list {
+			m = fold(m)
+			switch {
+			case m == folded:
+				return i + 1, nil
+			case utf8.RuneCountInString(folded) >= MinMonthPrefix && strings.HasPrefix(m, folded):
+				abbreviated[i+1] = struct{}{}
+			}
+		}
+	}
+	if len(abbreviated) == 1 {
+		for index := range abbreviated {
+			return index, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown month %q", name)
+}
+
+// fold lowers s and removes its accents, to compare month names.
+func fold(s string) string {
+	return strings.ToLower(accents.Remove(s))
+}
+
+// Expression returns the regular expression of the DATE_ANY pattern: the
+// numeric dates and the dates written with a month name of the months lists,
+// whole or abbreviated, ignoring case and accents.
+func Expression(months map[string][]string) string {
+	const (
+		day  = `(?:0?[1-9]|[12][0-9]|3[01])(?:er|st|nd|rd|th)?`
+		year = `(?:[0-9]{4}|[0-9]{2})`
+		sep  = `[ \t,.-]+`
+	)
+	forms := []string{
+		`[0-9]{4}[-/.][0-9]{1,2}[-/.][0-9]{1,2}`,
+		`[0-9]{1,2}[-/.][0-9]{1,2}[-/.]` + year,
+	}
+	if names := monthNames(months); len(names) > 0 {
+		month := `(?i:` + strings.Join(names, "|") + `)`
+		forms = append(forms, day+sep+month+sep+year, month+sep+day+sep+year)
+	}
+	return `\b(?:` + strings.Join(forms, "|") + `)\b`
+}
+
+// monthNames returns the expressions of the month names, longest first.
+func monthNames(months map[string][]string) []string {
+	set := make(map[string]struct{})
+	for _, list := range months {
+		for _, m := range list {
+			set[monthExpression(fold(m))] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(set))
+	for n := range set {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// monthExpression matches a month name or its abbreviations of at least
+// MinMonthPrefix letters: "mars" gives "mar(?:s)?", each letter matching its
+// accented forms too.
+func monthExpression(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i >= MinMonthPrefix {
+			b.WriteString("(?:")
+		}
+		b.WriteString(letterExpression(r))
+	}
+	for range len(runes) - MinMonthPrefix {
+		b.WriteString(")?")
+	}
+	return b.String()
+}
+
+func letterExpression(r rune) string {
+	variants := accents.Forms(r)
+	if variants == "" {
+		return regexp.QuoteMeta(string(r))
+	}
+	return "[" + string(r) + variants + "]"
+}
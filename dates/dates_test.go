@@ -0,0 +1,102 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package dates
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fileganizer/testutil"
+)
+
+var months = testutil.Months
+
+func TestParse(t *testing.T) {
+	p := Parser{Months: months}
+	tests := map[string]string{
+		"27 mars 2014":     "2014-03-27",
+		"27 MARS 14":       "2014-03-27",
+		"March 27, 2014":   "2014-03-27",
+		"Mar. 27th, 2014":  "2014-03-27",
+		"1er févr. 2014":   "2014-02-01",
+		"1 FEVRIER 2014":   "2014-02-01",
+		"15 aout 1999":     "1999-08-15",
+		"27-Mar-2014":      "2014-03-27",
+		"2014 mars 27":     "2014-03-27",
+		"27/03/14":         "2014-03-27",
+		"27.03.2014":       "2014-03-27",
+		"2014-03-27":       "2014-03-27",
+		"2014/3/7":         "2014-03-07",
+		"03/04/69":         "1969-04-03",
+		"03/04/68":         "2068-04-03",
+		" 5 décembre 2020": "2020-12-05",
+	}
+	for s, wants := range tests {
+		d, err := p.Parse(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, wants, d.Format("2006-01-02"), s)
+		}
+	}
+
+	p.Order = MonthFirst
+	d, err := p.Parse("03/04/2014")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2014, time.March, 4, 0, 0, 0, 0, time.UTC), d)
+	d, err = p.Parse("2014-03-04")
+	require.NoError(t, err)
+	assert.Equal(t, time.March, d.Month(), "year first dates are not affected by the order")
+}
+
+func TestParse_Invalid(t *testing.T) {
+	p := Parser{Months: months}
+	for _, s := range []string{
+		"",
+		"27 2014",
+		"31/02/2014",
+		"27 foo 2014",
+		"27 ju 2014",  // too short
+		"27 jui 2014", // juin or juillet
+		"27 mars avril 2014",
+		"27/13/2014",
+		"27/03/201",
+	} {
+		_, err := p.Parse(s)
+		assert.Error(t, err, s)
+	}
+	_, err := Parser{}.Parse("27 mars 2014")
+	assert.ErrorContains(t, err, "unknown month")
+}
+
+func TestParseOrder(t *testing.T) {
+	o, err := ParseOrder("monthFirst")
+	require.NoError(t, err)
+	assert.Equal(t, MonthFirst, o)
+	o, err = ParseOrder("dayFirst")
+	require.NoError(t, err)
+	assert.Equal(t, DayFirst, o)
+	_, err = ParseOrder("yearFirst")
+	assert.Error(t, err)
+}
+
+func TestExpression(t *testing.T) {
+	re := regexp.MustCompile(Expression(months))
+	p := Parser{Months: months}
+	for _, s := range []string{
+		"27 mars 2014", "27 Mars 14", "March 27, 2014", "Mar 27th, 2014", "1er févr. 2014", "15 AOÛT 1999", "15 aout 1999",
+		"27-Mar-2014", "27/03/14", "27.03.2014", "2014-03-27",
+	} {
+		text := "Date: " + s + " (due)"
+		assert.Equal(t, s, re.FindString(text), s)
+		_, err := p.Parse(re.FindString(text))
+		assert.NoError(t, err, s)
+	}
+	for _, s := range []string{"Total 12 34", "123/03/2014", "27 marsupial 2014", "ID 2014-03-271"} {
+		assert.Empty(t, re.FindString(s), s)
+	}
+	assert.NotContains(t, Expression(nil), "(?i:", "without months, only numeric dates are matched")
+}
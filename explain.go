@@ -0,0 +1,94 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"fileganizer/config"
+	"fileganizer/grok"
+)
+
+// explainFileDescriptions prints, for every file description, whether it
+// matched and how each of its patterns behaved, then whether the fallback
+// would run.
+func explainFileDescriptions(cfg *config.Config, txt string) error {
+	g, err := newGrok(cfg)
+	if err != nil {
+		return err
+	}
+	evals, err := evaluateFileDescriptions(&g, cfg, txt)
+	if err != nil {
+		return err
+	}
+	for _, e := range evals {
+		fmt.Printf("%s: %s\n", e.fd.Name, explainStatus(e))
+		explainPatterns(e.fd.Patterns, e.res.Hits, "  ", e.fd.Threshold > 0)
+	}
+	if cfg.Fallback != nil {
+		status := "not matched"
+		if !slices.ContainsFunc(evals, func(e evaluation) bool { return e.selected }) {
+			status = "matched"
+		}
+		fmt.Printf("%s: %s\n", cfg.Fallback.Name, status)
+	}
+	return nil
+}
+
+func explainStatus(e evaluation) string {
+	status := "not matched"
+	switch {
+	case e.selected:
+		status = "matched"
+	case e.res.Conflict != "":
+		return fmt.Sprintf("not matched (values of %s disagree)", e.res.Conflict)
+	case !e.res.Matched:
+	case e.fd.Threshold > 0 && e.res.Score >= e.fd.Threshold:
+		status = "not matched (outscored)"
+	}
+	if e.fd.Threshold > 0 {
+		status += fmt.Sprintf(" [score %g/%g]", e.res.Score, e.fd.Threshold)
+	}
+	return status
+}
+
+func explainPatterns(patterns []grok.Pattern, hits []grok.Hit, indent string, weighted bool) {
+	for i, p := range patterns {
+		line := fmt.Sprintf("%s%-18s %s", indent, explainHit(hits, i), p.String())
+		if weighted {
+			line += fmt.Sprintf(" (weight %g)", p.Weight)
+		}
+		fmt.Println(line)
+		var children []grok.Hit
+		if i < len(hits) {
+			children = hits[i].Children
+		}
+		if len(p.AllOf) > 0 {
+			explainPatterns(p.AllOf, children, indent+"  ", false)
+		}
+		if len(p.AnyOf) > 0 {
+			explainPatterns(p.AnyOf, children, indent+"  ", false)
+		}
+	}
+}
+
+func explainHit(hits []grok.Hit, i int) string {
+	if i >= len(hits) {
+		return "[skipped]"
+	}
+	h := hits[i]
+	switch {
+	case h.Pattern.Negate && h.Found:
+		return "[negate-found]"
+	case h.Pattern.Negate:
+		return "[negate-absent]"
+	case h.Found:
+		return "[found]"
+	case h.Pattern.Optional:
+		return "[optional-missing]"
+	default:
+		return "[missing]"
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fileganizer/config"
+	"fileganizer/logger"
+	"fileganizer/output"
+)
+
+// excerptLength is the number of characters of the text given to the fallback.
+const excerptLength = 500
+
+// processUnmatched handles a file that no description matches: the fallback
+// description runs, then the global onNoMatch hooks. Without a fallback, the
+// file is reported as unmatched. When the fallback handles it, a warning is
+// logged and the global afterRun hooks run.
+func processUnmatched(ctx context.Context, cfg *config.Config, o *output.Output, txt string) error {
+	file := cfg.InputFile
+	unmatched := runError{errUnmatched, fmt.Errorf("no file description matches %s", file)}
+	if cfg.Fallback != nil {
+		logger.Get().Info("No file description matches, running the fallback", "filename", file)
+		if err := processFallback(ctx, cfg, o, txt); err != nil {
+			return runError{errActionsFailed, errors.Join(unmatched, err)}
+		}
+	}
+	if err := runLists(ctx, cfg, o, runValues(cfg, nil), hooks(cfg, nil, config.HookOnNoMatch)); err != nil {
+		return runError{errActionsFailed, errors.Join(unmatched, err)}
+	}
+	if cfg.Fallback == nil {
+		return unmatched
+	}
+	logger.Get().Warn("No file description matches, the fallback handled it", "filename", file)
+	values := runValues(cfg, []string{cfg.Fallback.Name})
+	if err := runLists(ctx, cfg, o, values, hooks(cfg, nil, config.HookAfterRun)); err != nil {
+		return runError{errActionsFailed, err}
+	}
+	return nil
+}
+
+// processFallback runs the onMatch hooks of the fallback description, its
+// outputs and its afterRun hooks. When one of them fails, its onError hooks
+// run, then the global ones.
+func processFallback(ctx context.Context, cfg *config.Config, o *output.Output, txt string) error {
+	fd := cfg.Fallback
+	o.DateOrder = fd.DateOrder
+	o.Amounts.Decimal = fd.Decimal
+	values, err := fallbackValues(cfg, txt)
+	if err != nil {
+		return failed(ctx, cfg, o, fd, runValues(cfg, nil), err)
+	}
+	err = runLists(ctx, cfg, o, values, hooks(cfg, fd, config.HookOnMatch), outputList(fd), hooks(cfg, fd, config.HookAfterRun))
+	if err != nil {
+		return failed(ctx, cfg, o, fd, values, err)
+	}
+	return nil
+}
+
+// fallbackValues returns the variables of the templates of the fallback: the
+// ones of the outputs without captures, the metadata of the file in .file and
+// the beginning of its text in .text.
+func fallbackValues(cfg *config.Config, txt string) (map[string]any, error) {
+	info, err := os.Stat(cfg.InputFile)
+	if err != nil {
+		return nil, fmt.Errorf("fallback: %w", err)
+	}
+	return map[string]any{
+		"env":             cfg.EnvVars,
+		"grok":            map[string]any{},
+		"filename":        cfg.InputFile,
+		"fileDescription": cfg.Fallback.Name,
+		"file": map[string]any{
+			"name":    filepath.Base(cfg.InputFile),
+			"ext":     filepath.Ext(cfg.InputFile),
+			"dir":     filepath.Dir(cfg.InputFile),
+			"size":    info.Size(),
+			"modTime": info.ModTime(),
+		},
+		"text": excerpt(txt, excerptLength),
+	}, nil
+}
+
+// excerpt returns the first n characters of a text, with its runs of spaces
+// and newlines written as single spaces.
+func excerpt(txt string, n int) string {
+	runes := []rune(strings.Join(strings.Fields(txt), " "))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return string(runes[:n])
+}
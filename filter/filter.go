@@ -0,0 +1,229 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+// Package filter provides the post-processing filters that clean up captured
+// values before they are used in output templates.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fileganizer/dates"
+)
+
+// Filter transforms a captured value. A nil value stands for a field that was
+// not captured.
+type Filter func(v any) (any, error)
+
+// Chain is the list of filters applied in order to a field.
+type Chain []Filter
+
+// Apply runs the filters of the chain on v.
+func (c Chain) Apply(v any) (any, error) {
+	for _, f := range c {
+		var err error
+		if v, err = f(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Apply returns a copy of captures where the chain of each field of fields has
+// been applied. Fields without a capture get their chain applied to nil, so
+// that a default filter can provide a value.
+func Apply(captures map[string]any, fields map[string]Chain) (map[string]any, error) {
+	result := make(map[string]any, len(captures))
+	for k, v := range captures {
+		result[k] = v
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, err := fields[name].Apply(result[name])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		if v != nil {
+			result[name] = v
+		}
+	}
+	return result, nil
+}
+
+// Names of the available filters.
+const (
+	Trim         = "trim"
+	Replace      = "replace"
+	RegexReplace = "regexReplace"
+	Lower        = "lower"
+	Upper        = "upper"
+	Default      = "default"
+	MonthIndex   = "monthIndex"
+	DateParse    = "dateParse"
+	Truncate     = "truncate"
+)
+
+// New returns the filter called name, configured with arg (nil when the filter
+// was given without argument). months are the configured month lists that
+// monthIndex looks names up in.
+func New(name string, arg any, months map[string][]string) (Filter, error) {
+	switch name {
+	case Trim:
+		return trim(arg)
+	case Replace:
+		return replace(arg)
+	case RegexReplace:
+		return regexReplace(arg)
+	case Lower:
+		return onString(strings.ToLower), nil
+	case Upper:
+		return onString(strings.ToUpper), nil
+	case Default:
+		return byDefault(arg)
+	case MonthIndex:
+		return onString(func(s string) string { return monthIndex(s, months) }), nil
+	case DateParse:
+		return dateParse(arg)
+	case Truncate:
+		return truncate(arg)
+	default:
+		return nil, fmt.Errorf("unknown filter %q", name)
+	}
+}
+
+// onString lifts a string function to a filter. Values that are not strings
+// are formatted first; missing values are left missing.
+func onString(f func(string) string) Filter {
+	return func(v any) (any, error) {
+		if v == nil {
+			return nil, nil
+		}
+		return f(fmt.Sprint(v)), nil
+	}
+}
+
+func trim(arg any) (Filter, error) {
+	if arg == nil {
+		return onString(strings.TrimSpace), nil
+	}
+	cutset, ok := arg.(string)
+	if !ok {
+		return nil, fmt.Errorf("trim takes the characters to trim, got %v", arg)
+	}
+	return onString(func(s string) string { return strings.Trim(s, cutset) }), nil
+}
+
+func replace(arg any) (Filter, error) {
+	args, err := stringArgs(Replace, arg, 2) //nolint:mnd
+	if err != nil {
+		return nil, err
+	}
+	return onString(func(s string) string { return strings.ReplaceAll(s, args[0], args[1]) }), nil
+}
+
+func regexReplace(arg any) (Filter, error) {
+	args, err := stringArgs(RegexReplace, arg, 2) //nolint:mnd
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("regexReplace: %w", err)
+	}
+	return onString(func(s string) string { return re.ReplaceAllString(s, args[1]) }), nil
+}
+
+func byDefault(arg any) (Filter, error) {
+	if arg == nil {
+		return nil, fmt.Errorf("default needs a value")
+	}
+	return func(v any) (any, error) {
+		if v == nil || v == "" {
+			return arg, nil
+		}
+		return v, nil
+	}, nil
+}
+
+func dateParse(arg any) (Filter, error) {
+	var layouts []string
+	if s, ok := arg.(string); ok {
+		layouts = []string{s}
+	} else {
+		var err error
+		if layouts, err = stringArgs(DateParse, arg, -1); err != nil {
+			return nil, err
+		}
+	}
+	if len(layouts) == 0 {
+		return nil, fmt.Errorf("dateParse needs a layout")
+	}
+	return func(v any) (any, error) {
+		if v == nil {
+			return nil, nil
+		}
+		if t, ok := v.(time.Time); ok {
+			return t, nil
+		}
+		s := strings.TrimSpace(fmt.Sprint(v))
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("dateParse: %q does not match %v", s, layouts)
+	}, nil
+}
+
+func truncate(arg any) (Filter, error) {
+	n, ok := arg.(int)
+	if !ok || n < 1 {
+		return nil, fmt.Errorf("truncate takes a positive length, got %v", arg)
+	}
+	return onString(func(s string) string {
+		if utf8.RuneCountInString(s) <= n {
+			return s
+		}
+		return string([]rune(s)[:n])
+	}), nil
+}
+
+// stringArgs checks that arg is a list of n strings, or of any number of
+// strings when n is negative.
+func stringArgs(name string, arg any, n int) ([]string, error) {
+	list, ok := arg.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s takes a list of strings, got %v", name, arg)
+	}
+	if n >= 0 && len(list) != n {
+		return nil, fmt.Errorf("%s takes %d strings, got %v", name, n, arg)
+	}
+	args := make([]string, 0, len(list))
+	for _, a := range list {
+		s, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s takes strings, got %v", name, a)
+		}
+		args = append(args, s)
+	}
+	return args, nil
+}
+
+// monthIndex returns the zero-padded number of a month name from the month
+// lists, as dates.MonthIndex reads it. Unknown names are returned as is.
+func monthIndex(month string, months map[string][]string) string {
+	index, err := dates.MonthIndex(month, months)
+	if err != nil {
+		return month
+	}
+	return fmt.Sprintf("%02d", index)
+}
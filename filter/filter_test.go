@@ -0,0 +1,99 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fileganizer/testutil"
+)
+
+var months = testutil.Months
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  any
+		in   any
+		want any
+	}{
+		{Trim, nil, "  42 \n", "42"},
+		{Trim, "*", "**42*", "42"},
+		{Replace, []any{" ", ""}, "1 234 567", "1234567"},
+		{RegexReplace, []any{`[/\\]`, "-"}, `a/b\c`, "a-b-c"},
+		{Lower, nil, "ABC", "abc"},
+		{Upper, nil, "ab-12", "AB-12"},
+		{Upper, nil, nil, nil},
+		{Default, "unknown", nil, "unknown"},
+		{Default, "unknown", "", "unknown"},
+		{Default, "unknown", "x", "x"},
+		{MonthIndex, nil, "Mars", "03"},
+		{MonthIndex, nil, "févr.", "02"},
+		{MonthIndex, nil, "fevrier", "02"},
+		{MonthIndex, nil, "SEPT", "09"},
+		{MonthIndex, nil, "jui.", "jui."},
+		{MonthIndex, nil, "Brumaire", "Brumaire"},
+		{DateParse, "02/01/2006", "27/03/2014", time.Date(2014, 3, 27, 0, 0, 0, 0, time.UTC)},
+		{DateParse, []any{"2006-01-02", "January 2, 2006"}, "March 27, 2014", time.Date(2014, 3, 27, 0, 0, 0, 0, time.UTC)},
+		{Truncate, 3, "Façade", "Faç"},
+		{Truncate, 10, int64(42), "42"},
+	}
+	for _, tt := range tests {
+		f, err := New(tt.name, tt.arg, months)
+		require.NoError(t, err, tt.name)
+		got, err := f(tt.in)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, got, "%s %v on %v", tt.name, tt.arg, tt.in)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  any
+		want string
+	}{
+		{"rot13", nil, "unknown filter"},
+		{Trim, 42, "characters to trim"},
+		{Replace, "x", "list of strings"},
+		{Replace, []any{"x"}, "takes 2 strings"},
+		{RegexReplace, []any{"(", ""}, "regexReplace"},
+		{Default, nil, "needs a value"},
+		{DateParse, nil, "list of strings"},
+		{DateParse, []any{}, "needs a layout"},
+		{Truncate, -1, "positive length"},
+		{Truncate, 0, "positive length"},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.name, tt.arg, months)
+		assert.ErrorContains(t, err, tt.want, tt.name)
+	}
+}
+
+func TestApply(t *testing.T) {
+	trim, err := New(Trim, nil, nil)
+	require.NoError(t, err)
+	upper, err := New(Upper, nil, nil)
+	require.NoError(t, err)
+	def, err := New(Default, "none", nil)
+	require.NoError(t, err)
+	date, err := New(DateParse, "2006-01-02", nil)
+	require.NoError(t, err)
+
+	captures := map[string]any{"id": " ab12 ", "other": "kept"}
+	result, err := Apply(captures, map[string]Chain{
+		"id":  {trim, upper},
+		"ref": {trim, def},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"id": "AB12", "other": "kept", "ref": "none"}, result)
+	assert.Equal(t, " ab12 ", captures["id"], "captures are not modified")
+
+	_, err = Apply(map[string]any{"issued": "soon"}, map[string]Chain{"issued": {date}})
+	assert.ErrorContains(t, err, "field issued: dateParse")
+}
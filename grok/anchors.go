@@ -0,0 +1,262 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package grok
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"fileganizer/logger"
+	"fileganizer/matcher"
+)
+
+// confusionClasses are the characters that OCR engines commonly mistake for
+// one another. A literal character of a fuzzy anchor matches any character of
+// its class.
+var confusionClasses = []string{"l1I|", "O0Q", "o0", "S5", "B8", "Z2", "e3", "g9"}
+
+// confusionSequences are the character sequences that OCR engines commonly
+// mistake for one another, such as "rn" read instead of "m".
+var confusionSequences = [][]string{{"rn", "m"}, {"vv", "w"}, {"cl", "d"}, {"fi", "ﬁ"}, {"fl", "ﬂ"}}
+
+// MinAnchorLength is the number of runes, spaces excluded, below which a
+// literal part of a pattern is too short to tolerate an edit distance.
+const MinAnchorLength = 4
+
+// repeatRegexp matches a {n}, {n,} or {n,m} repetition.
+var repeatRegexp = regexp.MustCompile(`^\{\d+(?:,\d*)?\}`)
+
+// segment is a part of a pattern: either literal text, unescaped, or raw
+// regular expression and grok syntax kept as is.
+type segment struct {
+	text    string
+	literal bool
+}
+
+// splitLiterals cuts a grok pattern into literal text and syntax. A literal
+// character followed by a quantifier is kept as syntax so that rewriting the
+// literal parts never changes what a quantifier applies to.
+func splitLiterals(pattern string) []segment {
+	var segments []segment
+	add := func(text string, literal bool) {
+		if n := len(segments); n > 0 && segments[n-1].literal == literal {
+			segments[n-1].text += text
+			return
+		}
+		segments = append(segments, segment{text: text, literal: literal})
+	}
+	for i := 0; i < len(pattern); {
+		n := syntaxLen(pattern[i:])
+		if n == 0 {
+			r, size := utf8.DecodeRuneInString(pattern[i:])
+			if pattern[i] == '\\' {
+				r, size = utf8.DecodeRuneInString(pattern[i+1:])
+				size++
+			}
+			if syntaxLen(pattern[i+size:]) > 0 && strings.ContainsAny(pattern[i+size:i+size+1], "*+?{") {
+				add(regexp.QuoteMeta(string(r)), false)
+			} else {
+				add(string(r), true)
+			}
+			i += size
+			continue
+		}
+		add(pattern[i:i+n], false)
+		i += n
+	}
+	return segments
+}
+
+// syntaxLen returns the length of the regular expression or grok syntax at the
+// start of s, or 0 when s starts with a literal character.
+func syntaxLen(s string) int {
+	switch {
+	case s == "":
+		return 0
+	case strings.HasPrefix(s, "%{"):
+		return closingLen(s, '}')
+	case s[0] == '\\':
+		return escapeLen(s)
+	case s[0] == '[':
+		return classLen(s)
+	case strings.HasPrefix(s, "(?P<"), strings.HasPrefix(s, "(?<"):
+		return closingLen(s, '>')
+	case strings.HasPrefix(s, "(?"):
+		if end := strings.IndexAny(s, ":)"); end > 0 {
+			return end + 1
+		}
+		return len(s)
+	case strings.ContainsAny(s[:1], ".^$|()*+?"):
+		return 1
+	default:
+		return len(repeatRegexp.FindString(s))
+	}
+}
+
+// closingLen returns the length of s up to and including the first c.
+func closingLen(s string, c byte) int {
+	if end := strings.IndexByte(s, c); end > 0 {
+		return end + 1
+	}
+	return len(s)
+}
+
+// escapeLen returns the length of an escape sequence such as \d, \pL or
+// \p{Greek}, or 0 for an escaped literal character such as \. or \(.
+func escapeLen(s string) int {
+	switch {
+	case strings.HasPrefix(s, `\p{`), strings.HasPrefix(s, `\P{`), strings.HasPrefix(s, `\x{`):
+		return closingLen(s, '}')
+	case strings.HasPrefix(s, `\p`), strings.HasPrefix(s, `\P`):
+		return min(3, len(s))
+	case len(s) > 1 && s[1] < utf8.RuneSelf && (unicode.IsLetter(rune(s[1])) || unicode.IsDigit(rune(s[1]))):
+		return 2
+	default:
+		return 0
+	}
+}
+
+// classLen returns the length of the character class at the start of s.
+func classLen(s string) int {
+	i := 1
+	if strings.HasPrefix(s[i:], "^") {
+		i++
+	}
+	if strings.HasPrefix(s[i:], "]") {
+		i++
+	}
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ']':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// fuzzyPattern rewrites the literal parts of a grok pattern so that each
+// character also matches the characters OCR engines confuse it with.
+func fuzzyPattern(pattern string) string {
+	var b strings.Builder
+	for _, s := range splitLiterals(pattern) {
+		if !s.literal {
+			b.WriteString(s.text)
+			continue
+		}
+		b.WriteString(confusable(s.text))
+	}
+	return b.String()
+}
+
+func confusable(literal string) string {
+	var b strings.Builder
+next:
+	for i := 0; i < len(literal); {
+		for _, seq := range confusionSequences {
+			for _, variant := range seq {
+				if strings.HasPrefix(literal[i:], variant) {
+					b.WriteString("(?:" + quoteAll(seq) + ")")
+					i += len(variant)
+					continue next
+				}
+			}
+		}
+		r, size := utf8.DecodeRuneInString(literal[i:])
+		i += size
+		class := ""
+		for _, c := range confusionClasses {
+			if strings.ContainsRune(c, r) {
+				class += c
+			}
+		}
+		if class == "" {
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			continue
+		}
+		b.WriteString("[" + regexp.QuoteMeta(class) + "]")
+	}
+	return b.String()
+}
+
+// quoteAll returns the alternation of some literal texts.
+func quoteAll(alternatives []string) string {
+	quoted := make([]string, 0, len(alternatives))
+	for _, a := range alternatives {
+		quoted = append(quoted, regexp.QuoteMeta(a))
+	}
+	return strings.Join(quoted, "|")
+}
+
+// snapAnchors replaces the parts of text that are within distance edits of
+// the literal parts of the pattern by these literals, so that an exact match
+// of the anchors can succeed. The anchors are looked for in the order of the
+// pattern, each one after the previous, and only their first occurrence, so
+// that the text of the captures is left untouched. When all is set, for
+// patterns whose every occurrence is collected, the anchors are looked for
+// again after the last one until one is missing. Literal parts shorter than
+// MinAnchorLength, or not longer than twice the distance, are left out.
+func snapAnchors(pattern, text string, distance int, all bool) string {
+	if distance <= 0 {
+		return text
+	}
+	var anchors [][]rune
+	for _, s := range splitLiterals(pattern) {
+		anchor := []rune(strings.TrimSpace(s.text))
+		if s.literal && len(anchor)-strings.Count(string(anchor), " ") >= MinAnchorLength && len(anchor) > 2*distance {
+			anchors = append(anchors, anchor)
+		}
+	}
+	if len(anchors) == 0 {
+		return text
+	}
+	runes, cursor := []rune(text), 0
+	for {
+		for _, anchor := range anchors {
+			start, end, ok := firstNear(runes[cursor:], anchor, distance)
+			if !ok {
+				return string(runes)
+			}
+			start, end = start+cursor, end+cursor
+			if string(runes[start:end]) != string(anchor) {
+				logger.Get().Debug("Snapping OCR anchor", "anchor", string(anchor), "text", string(runes[start:end]))
+			}
+			runes = append(runes[:start], append(slices.Clone(anchor), runes[end:]...)...)
+			cursor = start + len(anchor)
+		}
+		if !all {
+			return string(runes)
+		}
+	}
+}
+
+// firstNear finds the first part of text within distance edits of anchor,
+// without the spaces or line breaks around it.
+func firstNear(text, anchor []rune, distance int) (int, int, bool) {
+	// The distance of the best part of text[:j] decreases as j grows: look
+	// for the first j where it is small enough, then for the best part
+	// around it.
+	if _, _, d := matcher.Nearest(anchor, text); d > distance {
+		return 0, 0, false
+	}
+	j := sort.Search(len(text), func(j int) bool {
+		_, _, d := matcher.Nearest(anchor, text[:j])
+		return d <= distance
+	})
+	from := max(0, j-len(anchor)-distance)
+	start, end, _ := matcher.Nearest(anchor, text[from:min(len(text), j+distance)])
+	start, end = start+from, end+from
+	for end > start && unicode.IsSpace(text[end-1]) && !unicode.IsSpace(anchor[len(anchor)-1]) {
+		end--
+	}
+	for start < end && unicode.IsSpace(text[start]) && !unicode.IsSpace(anchor[0]) {
+		start++
+	}
+	return start, end, true
+}
@@ -4,58 +4,465 @@
 package grok
 
 import (
+	"fmt"
+	"regexp"
+
 	"github.com/logrusorgru/grokky"
 
+	"fileganizer/amounts"
+	"fileganizer/dates"
 	"fileganizer/logger"
+	"fileganizer/matcher"
+)
+
+// Engine names selectable per pattern entry. EngineGrok is the default.
+const (
+	EngineGrok        = "grok"
+	EngineRegex       = "regex"
+	EngineKeywords    = "keywords"
+	EngineAnyKeywords = "anyKeywords"
+	EngineFuzzy       = "fuzzy"
+	EngineAnyFuzzy    = "anyFuzzy"
 )
 
-// Grok wraps a grokky host to compile and match grok patterns against text.
+// engines are the matchers available beside grok itself.
+var engines = map[string]matcher.Matcher{
+	EngineRegex:       matcher.Regex{},
+	EngineKeywords:    matcher.Keywords{},
+	EngineAnyKeywords: matcher.Keywords{Any: true},
+	EngineFuzzy:       matcher.Fuzzy{},
+	EngineAnyFuzzy:    matcher.Fuzzy{Any: true},
+}
+
+// IsEngine reports whether name is a known matching engine.
+func IsEngine(name string) bool {
+	_, ok := engines[name]
+	return ok || name == EngineGrok
+}
+
+// Grok matches grok patterns against text. Its patterns are kept in a grokky
+// host, which checks them as they are registered.
+// Conversion tells how typed captures that fail to convert are reported.
+// Dates reads the date captures that have no layout, and Amounts the amount
+// captures.
 type Grok struct {
-	host grokky.Host
+	host       grokky.Host
+	Conversion ConversionPolicy
+	Dates      dates.Parser
+	Amounts    amounts.Parser
+}
+
+// Pattern is one entry of a file description's pattern list. A plain pattern
+// must match. An Optional pattern contributes its captures when found but
+// never rejects the description. A Negate pattern rejects the description
+// when found and never contributes captures.
+//
+// Instead of a single grok Pattern, an entry may hold a group: AllOf is found
+// when all of its entries are satisfied, AnyOf is found as soon as one of its
+// entries is satisfied and keeps the captures of that first alternative only.
+//
+// When FindAll is set, every occurrence of the grok Pattern is collected as a
+// list of capture maps under that name instead of being merged into the
+// captures of the description.
+//
+// Weight is what the entry adds to the score of its description when found.
+//
+// Engine selects the matcher of the Pattern; grok is used when it is empty.
+//
+// FuzzyAnchors makes the literal parts of a grok Pattern tolerate OCR errors:
+// each character also matches the characters it is commonly confused with,
+// and the first parts of the text within AnchorDistance edits of the literal
+// parts, in order, are read as these literals. Captures are still matched
+// exactly.
+type Pattern struct {
+	Engine         string
+	Pattern        string
+	Optional       bool
+	Negate         bool
+	AnyOf          []Pattern
+	AllOf          []Pattern
+	FindAll        string
+	Weight         float64
+	FuzzyAnchors   bool
+	AnchorDistance int
+}
+
+// String returns the grok pattern, or the group kind for a group entry.
+func (p Pattern) String() string {
+	switch {
+	case len(p.AllOf) > 0:
+		return "allOf"
+	case len(p.AnyOf) > 0:
+		return "anyOf"
+	default:
+		return p.Pattern
+	}
+}
+
+// Hit records how a single pattern behaved during Evaluate. Children holds the
+// hits of the entries of a group that were evaluated, and Conflict the
+// must-equal field whose values disagreed within an allOf group.
+type Hit struct {
+	Pattern  Pattern
+	Found    bool
+	Captures map[string]any
+	Lists    map[string][]map[string]any
+	Children []Hit
+	Conflict string
+}
+
+// Satisfied reports whether the hit lets its description match.
+func (h Hit) Satisfied() bool {
+	switch {
+	case h.Pattern.Negate:
+		return !h.Found
+	case h.Pattern.Optional:
+		return true
+	default:
+		return h.Found
+	}
+}
+
+// Result is the outcome of evaluating a pattern list against text. Hits holds
+// one entry per evaluated pattern, in order; evaluation stops at the first
+// pattern that rejects the description. Conflict names the must-equal field
+// whose values disagreed, within a group too, if that is what rejected the
+// description. Score is
+// the sum of the weights of the entries found, negated ones excepted.
+type Result struct {
+	Matched  bool
+	Conflict string
+	Score    float64
+	Captures map[string]any
+	Lists    map[string][]map[string]any
+	Hits     []Hit
 }
 
-// New creates a Grok instance and registers the given named patterns.
+// New creates a Grok instance preloaded with the standard pattern Library and
+// registers the given named patterns, which override library patterns of the
+// same name.
 func New(patterns map[string]string) (Grok, error) {
 	var g Grok
 	g.host = grokky.New()
-	for k, p := range patterns {
-		if err := g.host.Add(k, p); err != nil {
-			return g, err
-		}
+	library, err := Library()
+	if err != nil {
+		return g, err
+	}
+	if err := g.addAll(library); err != nil {
+		return g, err
+	}
+	if err := g.addAll(patterns); err != nil {
+		return g, err
 	}
 	return g, nil
 }
 
+// Evaluate applies each pattern in order and merges the named captures of the
+// patterns that were found into a single map, following the merge policy of
+// each field (MergeLast when merge has none). A required pattern that is not
+// found, a negated pattern that is found, or a must-equal field whose values
+// differ stops the evaluation and leaves Matched false.
+func (g *Grok) Evaluate(patterns []Pattern, merge map[string]MergePolicy, text string) (Result, error) {
+	return g.evaluate(patterns, merge, text, false)
+}
+
+// Score is like Evaluate but a required pattern that is not found only lowers
+// the score instead of stopping the evaluation: every pattern is tried, and
+// Matched is only left false by a negated pattern or a must-equal conflict.
+// Comparing the score with a threshold is up to the caller.
+func (g *Grok) Score(patterns []Pattern, merge map[string]MergePolicy, text string) (Result, error) {
+	return g.evaluate(patterns, merge, text, true)
+}
+
+func (g *Grok) evaluate(patterns []Pattern, merge map[string]MergePolicy, text string, scoring bool) (Result, error) {
+	res := Result{
+		Captures: make(map[string]any),
+		Lists:    make(map[string][]map[string]any),
+	}
+	for _, p := range patterns {
+		hit, err := g.evaluatePattern(p, merge, text)
+		if err != nil {
+			return Result{}, err
+		}
+		res.Hits = append(res.Hits, hit)
+		if !hit.Satisfied() && (!scoring || p.Negate || hit.Conflict != "") {
+			logger.Get().Debug("Pattern rejected the description", "pattern", p.String(), "found", hit.Found)
+			res.Conflict = hit.Conflict
+			return res, nil
+		}
+		if !hit.Found || p.Negate {
+			continue
+		}
+		res.Score += p.Weight
+		for k, v := range hit.Captures {
+			if !mergeCapture(res.Captures, merge, k, v) {
+				logger.Get().Debug("Field values disagree", "field", k, "pattern", p.String())
+				res.Conflict = k
+				return res, nil
+			}
+		}
+		for k, v := range hit.Lists {
+			res.Lists[k] = v
+		}
+	}
+	res.Matched = true
+	return res, nil
+}
+
+// evaluatePattern looks for a single entry, recursing into groups. The
+// returned hit only carries captures when the entry was found and is not
+// negated.
+func (g *Grok) evaluatePattern(p Pattern, merge map[string]MergePolicy, text string) (Hit, error) {
+	hit := Hit{Pattern: p}
+	var captures map[string]any
+	var lists map[string][]map[string]any
+	switch {
+	case len(p.AllOf) > 0:
+		res, err := g.Evaluate(p.AllOf, merge, text)
+		if err != nil {
+			return hit, err
+		}
+		hit.Found, hit.Children, captures, lists = res.Matched, res.Hits, res.Captures, res.Lists
+		hit.Conflict = res.Conflict
+	case len(p.AnyOf) > 0:
+		for _, alt := range p.AnyOf {
+			h, err := g.evaluatePattern(alt, merge, text)
+			if err != nil {
+				return hit, err
+			}
+			hit.Children = append(hit.Children, h)
+			// An optional alternative would always be satisfied: it only
+			// counts when found.
+			if h.Found != alt.Negate {
+				hit.Found, captures, lists = true, h.Captures, h.Lists
+				break
+			}
+		}
+	case p.FindAll != "":
+		all, err := g.ParseEach(anchored(p, text))
+		if err != nil {
+			return hit, err
+		}
+		hit.Found = len(all) > 0
+		lists = map[string][]map[string]any{p.FindAll: all}
+	default:
+		var err error
+		captures, hit.Found, err = g.matcher(p.Engine).Match(anchored(p, text))
+		if err != nil {
+			return hit, err
+		}
+	}
+	if hit.Found && !p.Negate {
+		hit.Captures, hit.Lists = captures, lists
+	}
+	return hit, nil
+}
+
+// anchored returns the pattern and text to match for an entry, rewritten for
+// fuzzy anchors when the entry asks for them.
+func anchored(p Pattern, text string) (string, string) {
+	if !p.FuzzyAnchors || (p.Engine != "" && p.Engine != EngineGrok) {
+		return p.Pattern, text
+	}
+	return fuzzyPattern(p.Pattern), snapAnchors(p.Pattern, text, p.AnchorDistance, p.FindAll != "")
+}
+
 // ParseAll applies each grok pattern in order and merges all named captures
-// into a single result map. All patterns must match on the text; the first
-// non-matching pattern aborts the entire set and returns nil.
-func (g *Grok) ParseAll(grokPatterns []string, text string) (map[string]string, error) {
-	var result = make(map[string]string)
-	for _, p := range grokPatterns {
-		r, err := g.Parse(p, text)
+// into a single result map. All required patterns must match on the text and
+// no negated pattern may match; otherwise it returns nil.
+func (g *Grok) ParseAll(grokPatterns []Pattern, text string) (map[string]any, error) {
+	res, err := g.Evaluate(grokPatterns, nil, text)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Matched {
+		return nil, nil
+	}
+	return res.Captures, nil
+}
+
+// matcher returns the matcher of an engine: g itself for grok, or a matcher
+// that always fails for an unknown engine.
+func (g *Grok) matcher(engine string) matcher.Matcher {
+	if engine == "" || engine == EngineGrok {
+		return g
+	}
+	if m, ok := engines[engine]; ok {
+		return m
+	}
+	return unknownEngine(engine)
+}
+
+type unknownEngine string
+
+func (e unknownEngine) Match(_, _ string) (map[string]any, bool, error) {
+	return nil, false, fmt.Errorf("unknown matching engine %q", string(e))
+}
+
+// Parse compiles a single grok pattern and extracts named captures from text.
+// Typed captures such as %{NUMBER:total:float} are converted to their type.
+func (g *Grok) Parse(grokPattern, text string) (map[string]any, error) {
+	result, _, err := g.Match(grokPattern, text)
+	return result, err
+}
+
+// ParseEach compiles a single grok pattern and extracts the named captures of
+// every non-overlapping occurrence in text, in order.
+func (g *Grok) ParseEach(grokPattern, text string) ([]map[string]any, error) {
+	l := logger.Get()
+	l.Debug("Testing pattern for all occurrences", "pattern", grokPattern, "text", text)
+	re, conversions, err := g.compile(grokPattern)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]any, 0)
+	for _, m := range re.FindAllStringSubmatch(text, -1) {
+		r, err := g.convert(captures(re, m), conversions)
 		if err != nil {
 			return nil, err
 		}
-		if len(r) == 0 {
-			logger.Get().Debug("No pattern matched", "pattern", p)
-			return nil, nil
-		}
-		for k, v := range r {
-			result[k] = v
+		if r != nil {
+			result = append(result, r)
 		}
 	}
 	return result, nil
 }
 
-// Parse compiles a single grok pattern and extracts named captures from text.
-func (g *Grok) Parse(grokPattern, text string) (map[string]string, error) {
+// Span is an occurrence of a pattern in text, as byte offsets. Groups holds
+// the offsets of each named capture that took part in the match.
+type Span struct {
+	Start, End int
+	Groups     []Group
+}
+
+// Group is a named capture of a Span.
+type Group struct {
+	Name       string
+	Start, End int
+}
+
+// referenceRegexp matches a %{NAME} or %{NAME:field} pattern reference.
+var referenceRegexp = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// Expand returns the regular expression that a grok pattern compiles to, with
+// every %{NAME} reference replaced and every capture as a named group.
+func (g *Grok) Expand(grokPattern string) (string, error) {
+	stripped, _, err := stripTypes(grokPattern)
+	if err != nil {
+		return "", err
+	}
+	return g.expand(stripped)
+}
+
+func (g *Grok) expand(expr string) (string, error) {
+	var err error
+	expanded := referenceRegexp.ReplaceAllStringFunc(expr, func(ref string) string {
+		m := referenceRegexp.FindStringSubmatch(ref)
+		sub, ok := g.host[m[1]]
+		if !ok {
+			err = fmt.Errorf("the '%s' pattern doesn't exist", m[1])
+			return ref
+		}
+		sub, subErr := g.expand(sub)
+		if subErr != nil {
+			err = subErr
+		}
+		if m[2] != "" {
+			return "(?P<" + m[2] + ">" + sub + ")"
+		}
+		return "(?:" + sub + ")"
+	})
+	return expanded, err
+}
+
+// Locate returns every non-overlapping occurrence of a grok pattern in text,
+// in order. Unlike ParseEach, captures are neither converted nor merged, so
+// that each one can be shown where it was found.
+func (g *Grok) Locate(grokPattern, text string) ([]Span, error) {
+	expanded, err := g.Expand(grokPattern)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, err
+	}
+	names := re.SubexpNames()
+	var spans []Span
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		span := Span{Start: m[0], End: m[1]}
+		for i, name := range names {
+			if name != "" && m[2*i] >= 0 {
+				span.Groups = append(span.Groups, Group{Name: name, Start: m[2*i], End: m[2*i+1]})
+			}
+		}
+		spans = append(spans, span)
+	}
+	return spans, nil
+}
+
+// Match is like Parse but also reports whether the pattern matched at all,
+// which the captures alone cannot tell for patterns without named fields. It
+// makes Grok a matcher.Matcher.
+func (g *Grok) Match(grokPattern, text string) (map[string]any, bool, error) {
 	l := logger.Get()
 	l.Debug("Testing pattern", "pattern", grokPattern, "text", text)
-	p, err := g.host.Compile(grokPattern)
+	re, conversions, err := g.compile(grokPattern)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return map[string]any{}, false, nil
+	}
+	r, err := g.convert(captures(re, m), conversions)
+	if err != nil || r == nil {
+		return map[string]any{}, false, err
 	}
-	result := p.Parse(text)
+	return r, true, nil
+}
 
-	return result, nil
+// compile expands a grok pattern into a regular expression whose captures are
+// named groups, and returns it with the conversions of its typed captures.
+func (g *Grok) compile(grokPattern string) (*regexp.Regexp, map[string]conversion, error) {
+	stripped, conversions, err := stripTypes(grokPattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	expanded, err := g.expand(stripped)
+	if err != nil {
+		return nil, nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, nil, err
+	}
+	return re, conversions, nil
+}
+
+// captures maps the named groups of re to their text in the submatches m.
+// When a name is used by several groups, as in alternatives, the first one
+// that captured some text wins.
+func captures(re *regexp.Regexp, m []string) map[string]string {
+	r := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" && r[name] == "" {
+			r[name] = m[i]
+		}
+	}
+	return r
+}
+
+// convert applies the conversions of typed captures. Under ConversionNoMatch a
+// failure is logged and reported as a nil map, meaning no match.
+func (g *Grok) convert(raw map[string]string, conversions map[string]conversion) (map[string]any, error) {
+	r, err := convertAll(raw, conversions, parsers{dates: g.Dates, amounts: g.Amounts})
+	if err == nil {
+		return r, nil
+	}
+	if g.Conversion == ConversionError {
+		return nil, err
+	}
+	logger.Get().Debug("Treating failed conversion as no match", "error", err)
+	return nil, nil
 }
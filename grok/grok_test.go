@@ -4,10 +4,16 @@
 package grok
 
 import (
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"fileganizer/amounts"
+	"fileganizer/dates"
 )
 
 const contents = "Some text\n" +
@@ -26,6 +32,14 @@ var grokPatterns = map[string]string{
 	"MONTHDAY":            "(?:0[1-9])|(?:[12][0-9])|(?:3[01])|[1-9]",
 }
 
+func toPatterns(ps []string) []Pattern {
+	patterns := make([]Pattern, 0, len(ps))
+	for _, p := range ps {
+		patterns = append(patterns, Pattern{Pattern: p})
+	}
+	return patterns
+}
+
 var patternsMatching = []string{
 	"Identifier : %{NUMBER:identifier}",
 	"date %{YEAR:year} is",
@@ -40,7 +54,12 @@ var patternsNotMatching = []string{
 func TestNew(t *testing.T) {
 	g, err := New(grokPatterns)
 	assert.NoError(t, err)
-	assert.Equal(t, len(grokPatterns), len(g.host))
+	for k, p := range grokPatterns {
+		assert.Equal(t, p, g.host[k])
+	}
+	library, err := Library()
+	require.NoError(t, err)
+	assert.Len(t, g.host, len(library)+3, "STRING, JUSTMATCH and SPACESANDEMPTYLINES are not library patterns")
 }
 
 func TestParseOK(t *testing.T) {
@@ -64,11 +83,26 @@ func TestParseNothing(t *testing.T) {
 	}
 }
 
+func TestMatch_SameNameInAlternatives(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	r, ok, err := g.Match(`(?:total %{NUMBER:amount}|%{NUMBER:amount} due)`, "125 due")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]any{"amount": "125"}, r)
+
+	r, ok, err = g.Match(`\d{5} %{WORD:city}`, "no postcode")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, r)
+}
+
 func TestParseAllOK(t *testing.T) {
 	g, err := New(grokPatterns)
 	require.NoError(t, err)
 
-	r, err := g.ParseAll(patternsMatching, contents)
+	r, err := g.ParseAll(toPatterns(patternsMatching), contents)
 	assert.NoError(t, err)
 	assert.Contains(t, r, "identifier")
 	assert.Equal(t, r["identifier"], "123")
@@ -80,7 +114,7 @@ func TestParseAllNothing(t *testing.T) {
 	g, err := New(grokPatterns)
 	require.NoError(t, err)
 
-	r, err := g.ParseAll(patternsNotMatching, contents)
+	r, err := g.ParseAll(toPatterns(patternsNotMatching), contents)
 	assert.NoError(t, err)
 	assert.Len(t, r, 0)
 }
@@ -105,11 +139,650 @@ func TestParseAll_ErrorMidChain(t *testing.T) {
 	require.NoError(t, err)
 
 	// First pattern matches, second fails
-	patterns := []string{
+	patterns := toPatterns([]string{
 		"Identifier : %{NUMBER:identifier}",
 		"%{NONEXISTENT:bad}",
-	}
+	})
 	_, err = g.ParseAll(patterns, contents)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "NONEXISTENT")
 }
+
+func TestParseAll_Optional(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{Pattern: "Identifier : %{NUMBER:identifier}"},
+		{Pattern: "PO : %{NUMBER:po}", Optional: true},
+		{Pattern: "date %{YEAR:year} is", Optional: true},
+	}
+	r, err := g.ParseAll(patterns, contents)
+	assert.NoError(t, err)
+	assert.Equal(t, "123", r["identifier"])
+	assert.Equal(t, "1970", r["year"])
+	assert.NotContains(t, r, "po")
+}
+
+func TestParseAll_Negate(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	absent := []Pattern{
+		{Pattern: "Identifier : %{NUMBER:identifier}"},
+		{Pattern: "DUPLICATA", Negate: true},
+	}
+	r, err := g.ParseAll(absent, contents)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"identifier": "123"}, r)
+
+	present := []Pattern{
+		{Pattern: "Identifier : %{NUMBER:identifier}"},
+		{Pattern: "beginning of time", Negate: true},
+	}
+	r, err = g.ParseAll(present, contents)
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+}
+
+func TestEvaluate_Hits(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{Pattern: "PO : %{NUMBER:po}", Optional: true},
+		{Pattern: "Some text"},
+		{Pattern: "Nothing : %{NUMBER:identifier}"},
+		{Pattern: "date %{YEAR:year} is"},
+	}
+	res, err := g.Evaluate(patterns, nil, contents)
+	require.NoError(t, err)
+	assert.False(t, res.Matched)
+	require.Len(t, res.Hits, 3)
+	assert.False(t, res.Hits[0].Found)
+	assert.True(t, res.Hits[1].Found, "patterns without captures are found too")
+	assert.False(t, res.Hits[2].Found)
+}
+
+func TestParseAll_AnyOf(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{AnyOf: []Pattern{
+			{Pattern: "Nothing : %{NUMBER:identifier}"},
+			{Pattern: "Other identifier : x%{NUMBER:identifier}"},
+			{Pattern: "Identifier : %{NUMBER:first}"},
+		}},
+	}
+	r, err := g.ParseAll(patterns, contents)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"identifier": "123"}, r, "only the first successful alternative is kept")
+
+	none := []Pattern{{AnyOf: toPatterns(patternsNotMatching)}}
+	r, err = g.ParseAll(none, contents)
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	optional := []Pattern{{AnyOf: []Pattern{
+		{Pattern: "Nothing : %{NUMBER:identifier}", Optional: true},
+		{Pattern: "Identifier : %{NUMBER:first}"},
+	}}}
+	r, err = g.ParseAll(optional, contents)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"first": "123"}, r, "an optional alternative only counts when found")
+
+	optional[0].AnyOf[1].Pattern = "Nothing either : %{NUMBER:first}"
+	r, err = g.ParseAll(optional, contents)
+	assert.NoError(t, err)
+	assert.Nil(t, r, "an anyOf of optional alternatives not found does not match")
+}
+
+func TestParseAll_AllOfInsideAnyOf(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{AnyOf: []Pattern{
+			{AllOf: []Pattern{
+				{Pattern: "Identifier : %{NUMBER:identifier}"},
+				{Pattern: "Nothing"},
+			}},
+			{AllOf: []Pattern{
+				{Pattern: "Identifier : %{NUMBER:identifier}"},
+				{Pattern: "date %{YEAR:year} is"},
+			}},
+		}},
+	}
+	res, err := g.Evaluate(patterns, nil, contents)
+	require.NoError(t, err)
+	assert.True(t, res.Matched)
+	assert.Equal(t, map[string]any{"identifier": "123", "year": "1970"}, res.Captures)
+	require.Len(t, res.Hits, 1)
+	require.Len(t, res.Hits[0].Children, 2)
+	assert.False(t, res.Hits[0].Children[0].Found)
+	assert.True(t, res.Hits[0].Children[1].Found)
+}
+
+func TestParseAll_GroupError(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	_, err = g.ParseAll([]Pattern{{AnyOf: []Pattern{{Pattern: "%{NONEXISTENT:bad}"}}}}, contents)
+	assert.Error(t, err)
+	_, err = g.ParseAll([]Pattern{{AllOf: []Pattern{{Pattern: "%{NONEXISTENT:bad}"}}}}, contents)
+	assert.Error(t, err)
+}
+
+func TestPatternString(t *testing.T) {
+	assert.Equal(t, "abc", Pattern{Pattern: "abc"}.String())
+	assert.Equal(t, "anyOf", Pattern{AnyOf: []Pattern{{Pattern: "a"}}}.String())
+	assert.Equal(t, "allOf", Pattern{AllOf: []Pattern{{Pattern: "a"}}}.String())
+}
+
+func TestParseEach(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	r, err := g.ParseEach("%{NUMBER:n}", contents)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"n": "123"}, {"n": "123"}, {"n": "1970"}}, r)
+
+	r, err = g.ParseEach(`\B%{NUMBER:n}`, "ref x12 and y345")
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"n": "12"}, {"n": "345"}}, r, "each occurrence is read in its context")
+
+	r, err = g.ParseEach("Nothing %{NUMBER:n}", contents)
+	assert.NoError(t, err)
+	assert.Empty(t, r)
+
+	_, err = g.ParseEach("%{NONEXISTENT:bad}", contents)
+	assert.Error(t, err)
+}
+
+func TestEvaluate_FindAll(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{Pattern: "Identifier : %{NUMBER:identifier}"},
+		{Pattern: "(?m)^%{STRING:word} ", FindAll: "words"},
+		{Pattern: "Nothing %{NUMBER:n}", FindAll: "none", Optional: true},
+	}
+	res, err := g.Evaluate(patterns, nil, contents)
+	require.NoError(t, err)
+	assert.True(t, res.Matched)
+	assert.Equal(t, map[string]any{"identifier": "123"}, res.Captures)
+	assert.Equal(t, []map[string]any{
+		{"word": "Some"}, {"word": "with"}, {"word": "Identifier"}, {"word": "Other"}, {"word": "Old"},
+	}, res.Lists["words"])
+	assert.NotContains(t, res.Lists, "none")
+
+	res, err = g.Evaluate([]Pattern{{Pattern: "Nothing %{NUMBER:n}", FindAll: "none"}}, nil, contents)
+	require.NoError(t, err)
+	assert.False(t, res.Matched)
+}
+
+func TestParse_TypedCaptures(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	text := "Total: 1200.50 EUR\nItems: 4\nPaid: true\nIssued: 27/03/2014\nDue: 2014-04-26\n"
+	r, err := g.Parse("Total: %{JUSTMATCH:total:float} EUR\\nItems: %{NUMBER:items:int}\\nPaid: %{STRING:paid:bool}\\n"+
+		"Issued: %{JUSTMATCH:issued:date(02/01/2006)}\\nDue: %{JUSTMATCH:due:date}\\n", text)
+	require.NoError(t, err)
+	assert.Equal(t, 1200.5, r["total"])
+	assert.Equal(t, int64(4), r["items"])
+	assert.Equal(t, true, r["paid"])
+	assert.Equal(t, time.Date(2014, time.March, 27, 0, 0, 0, 0, time.UTC), r["issued"])
+	assert.Equal(t, time.Date(2014, time.April, 26, 0, 0, 0, 0, time.UTC), r["due"])
+}
+
+func TestParse_TypedCaptureInOptionalGroup(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	pattern := `Items: %{NUMBER:items:int}(?:\nTotal %{NUMBER:total:float})?`
+	r, ok, err := g.Match(pattern, "Items: 4\nTotal 1200\n")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]any{"items": int64(4), "total": 1200.0}, r)
+
+	r, ok, err = g.Match(pattern, "Items: 4\n")
+	require.NoError(t, err)
+	assert.True(t, ok, "a typed capture that did not take part does not fail the match")
+	assert.Equal(t, map[string]any{"items": int64(4)}, r)
+}
+
+func TestParse_DateCapturesWithMonthNames(t *testing.T) {
+	months := map[string][]string{"MONTHSFRENCH": {"janvier", "février", "mars", "avril"}}
+	g, err := New(map[string]string{"DATE_ANY": dates.Expression(months)})
+	require.NoError(t, err)
+	g.Dates.Months = months
+
+	text := "Émise le 27 mars 2014\nÉchéance : 03/04/14\n"
+	r, err := g.Parse("le %{DATE_ANY:issued:date}\n.* : %{DATE_ANY:due:date}", text)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2014, time.March, 27, 0, 0, 0, 0, time.UTC), r["issued"])
+	assert.Equal(t, time.Date(2014, time.April, 3, 0, 0, 0, 0, time.UTC), r["due"])
+
+	g.Dates.Order = dates.MonthFirst
+	r, err = g.Parse(".* : %{DATE_ANY:due:date}", text)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2014, time.March, 4, 0, 0, 0, 0, time.UTC), r["due"])
+}
+
+func TestParse_AmountCaptures(t *testing.T) {
+	g, err := New(map[string]string{})
+	require.NoError(t, err)
+
+	text := "Total HT : 1.234,56 €\nTVA : 246,91\nTotal: USD 1,481.47\n"
+	r, err := g.Parse("HT : %{MONEY:net:amount}\nTVA : %{AMOUNT:vat:amount}\nTotal: %{MONEY:total:amount}", text)
+	require.NoError(t, err)
+	assert.Equal(t, amounts.Amount{Value: "1234.56", Currency: "EUR"}, r["net"])
+	assert.Equal(t, amounts.Amount{Value: "246.91"}, r["vat"])
+	assert.Equal(t, amounts.Amount{Value: "1481.47", Currency: "USD"}, r["total"])
+
+	g.Amounts = amounts.Parser{Decimal: amounts.DecimalPoint, Currency: "EUR"}
+	r, err = g.Parse("TVA : %{AMOUNT:vat:amount}", text)
+	require.NoError(t, err)
+	assert.Empty(t, r, "246,91 is not an amount with a decimal point")
+	r, err = g.Parse("Total: %{MONEY:total:amount}", text)
+	require.NoError(t, err)
+	assert.Equal(t, amounts.Amount{Value: "1481.47", Currency: "USD"}, r["total"])
+}
+
+func TestParse_TypedCaptureFailure(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	r, found, err := g.Match("Other identifier : %{STRING:id:int}", contents)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, r)
+
+	r, err = g.Parse("Old date %{NUMBER:d:date}", contents)
+	assert.NoError(t, err)
+	assert.Empty(t, r)
+
+	g.Conversion = ConversionError
+	_, err = g.Parse("Other identifier : %{STRING:id:int}", contents)
+	assert.ErrorIs(t, err, ErrConversion)
+	_, err = g.ParseEach("identifier : %{STRING:id:int}", contents)
+	assert.ErrorIs(t, err, ErrConversion)
+}
+
+func TestParse_UnknownType(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	_, err = g.Parse("%{NUMBER:n:complex}", contents)
+	assert.ErrorContains(t, err, "unknown type")
+}
+
+func TestParseEach_TypedCaptures(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	r, err := g.ParseEach("%{NUMBER:n:int}", contents)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"n": int64(123)}, {"n": int64(123)}, {"n": int64(1970)}}, r)
+
+	r, err = g.ParseEach("identifier : %{STRING:id:int}", contents)
+	assert.NoError(t, err)
+	assert.Empty(t, r, "occurrences that fail to convert are skipped")
+}
+
+func TestLibrary_Samples(t *testing.T) {
+	g, err := New(nil)
+	require.NoError(t, err)
+
+	samples := map[string][]string{
+		"NUMBER":            {"42", "-3.14"},
+		"DATE":              {"2014-03-27", "27/03/2014", "03-27-14"},
+		"TIMESTAMP_ISO8601": {"2014-03-27T10:42:00Z"},
+		"MONTH":             {"March", "mar", "Sept"},
+		"EMAILADDRESS":      {"john.doe+invoices@example.co.uk"},
+		"URI":               {"https://example.com/a/b?c=d"},
+		"IPV4":              {"192.168.1.254"},
+		"PHONE":             {"+33 1 23 45 67 89", "(555) 123-4567"},
+		"PHONE_FR":          {"01 23 45 67 89", "+33 6.12.34.56.78"},
+		"IBAN":              {"FR76 3000 6000 0112 3456 7890 189", "DE89370400440532013000"},
+		"BIC":               {"BNPAFRPPXXX", "DEUTDEFF"},
+		"EUVAT":             {"FR40303265045", "DE123456789", "NL123456789B01"},
+		"SIRET":             {"732 829 320 00074"},
+		"MONEY":             {"1 234,56 €", "€1,234.56", "12.50 EUR", "$ 3"},
+	}
+	for name, values := range samples {
+		for _, v := range values {
+			r, err := g.Parse("^%{"+name+":v}$", v)
+			assert.NoErrorf(t, err, "%s on %q", name, v)
+			assert.Equalf(t, v, r["v"], "%s on %q", name, v)
+		}
+	}
+}
+
+func TestNew_OverridesLibrary(t *testing.T) {
+	g, err := New(map[string]string{"NUMBER": "[0-9]+", "INVOICE": "INV-%{NUMBER}"})
+	require.NoError(t, err)
+
+	r, err := g.Parse("%{INVOICE:id}", "ref INV-12.5")
+	assert.NoError(t, err)
+	assert.Equal(t, "INV-12", r["id"])
+}
+
+func TestNew_PatternsInAnyOrder(t *testing.T) {
+	g, err := New(map[string]string{"A": "%{B}-%{C}", "B": "%{C}%{C}", "C": "[xy]"})
+	require.NoError(t, err)
+
+	r, err := g.Parse("%{A:a}", "__xy-y__")
+	assert.NoError(t, err)
+	assert.Equal(t, "xy-y", r["a"])
+
+	_, err = New(map[string]string{"A": "%{MISSING}"})
+	assert.ErrorContains(t, err, "grok pattern A")
+}
+
+func TestReadPatterns(t *testing.T) {
+	r, err := ReadPatterns(strings.NewReader("# comment\n\nFOO [a-z]+\nBAR %{FOO} +bar\nFOO [A-Z]+\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"FOO": "[A-Z]+", "BAR": "%{FOO} +bar"}, r)
+
+	_, err = ReadPatterns(strings.NewReader("FOO\n"))
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestEvaluate_MergePolicies(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{Pattern: "Identifier : %{NUMBER:id}"},
+		{Pattern: "Other identifier : x%{NUMBER:id}"},
+		{Pattern: "date %{YEAR:id} is"},
+	}
+	cases := map[MergePolicy]any{
+		MergeLast:  "1970",
+		MergeFirst: "123",
+		MergeList:  []any{"123", "123", "1970"},
+	}
+	for policy, want := range cases {
+		res, err := g.Evaluate(patterns, map[string]MergePolicy{"id": policy}, contents)
+		require.NoError(t, err)
+		assert.Truef(t, res.Matched, "policy %s", policy)
+		assert.Equalf(t, want, res.Captures["id"], "policy %s", policy)
+	}
+
+	res, err := g.Evaluate(patterns, map[string]MergePolicy{"id": MergeMustEqual}, contents)
+	require.NoError(t, err)
+	assert.False(t, res.Matched)
+	assert.Equal(t, "id", res.Conflict)
+
+	res, err = g.Evaluate(patterns[:2], map[string]MergePolicy{"id": MergeMustEqual}, contents)
+	require.NoError(t, err)
+	assert.True(t, res.Matched)
+	assert.Equal(t, "123", res.Captures["id"])
+
+	grouped := []Pattern{{AllOf: patterns}}
+	for _, evaluate := range []func([]Pattern, map[string]MergePolicy, string) (Result, error){g.Evaluate, g.Score} {
+		res, err = evaluate(grouped, map[string]MergePolicy{"id": MergeMustEqual}, contents)
+		require.NoError(t, err)
+		assert.False(t, res.Matched)
+		assert.Equal(t, "id", res.Conflict, "a conflict within a group rejects the description")
+		assert.Equal(t, "id", res.Hits[0].Conflict)
+	}
+}
+
+func TestEvaluate_MergeListNested(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{Pattern: "Identifier : %{NUMBER:id}"},
+		{AllOf: []Pattern{
+			{Pattern: "Other identifier : x%{NUMBER:id}"},
+			{Pattern: "date %{YEAR:id} is"},
+		}},
+	}
+	res, err := g.Evaluate(patterns, map[string]MergePolicy{"id": MergeList}, contents)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"123", "123", "1970"}, res.Captures["id"])
+}
+
+func TestParseMergePolicy(t *testing.T) {
+	p, err := ParseMergePolicy("must-equal")
+	assert.NoError(t, err)
+	assert.Equal(t, MergeMustEqual, p)
+
+	_, err = ParseMergePolicy("sometimes")
+	assert.ErrorContains(t, err, "unknown merge policy")
+}
+
+func TestConflicts(t *testing.T) {
+	patterns := []Pattern{
+		{Pattern: "No %{NUMBER:number} of %{DATE:date:date}"},
+		{Pattern: "Date: %{DATE:date}"},
+		{AnyOf: []Pattern{
+			{Pattern: "Ref %{NUMBER:ref}"},
+			{Pattern: "Reference %{NUMBER:ref}"},
+			{AllOf: []Pattern{{Pattern: "%{WORD:vendor}"}, {Pattern: "by %{WORD:vendor}"}}},
+		}},
+		{Pattern: "Number %{NUMBER:number}", Negate: true},
+		{Pattern: "%{NUMBER:number}", FindAll: "numbers"},
+	}
+	assert.Equal(t, []string{"date", "vendor"}, Conflicts(patterns))
+	assert.Equal(t, []string{"ref", "vendor"}, patterns[2].Fields())
+	assert.Equal(t, []string{"vendor"}, Conflicts(patterns[2:]))
+	assert.Empty(t, Conflicts(patterns[3:]))
+}
+
+func TestScore(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{Pattern: "Identifier : %{NUMBER:identifier}", Weight: 2},
+		{Pattern: "Nothing : %{NUMBER:nothing}", Weight: 3},
+		{Pattern: "date %{YEAR:year} is", Weight: 1.5},
+	}
+	res, err := g.Score(patterns, nil, contents)
+	require.NoError(t, err)
+	assert.True(t, res.Matched)
+	assert.InDelta(t, 3.5, res.Score, 1e-9)
+	assert.Len(t, res.Hits, 3)
+	assert.Equal(t, map[string]any{"identifier": "123", "year": "1970"}, res.Captures)
+
+	res, err = g.Evaluate(patterns, nil, contents)
+	require.NoError(t, err)
+	assert.False(t, res.Matched)
+	assert.InDelta(t, 2, res.Score, 1e-9)
+
+	rejected := append([]Pattern{{Pattern: "beginning of time", Negate: true, Weight: 10}}, patterns...)
+	res, err = g.Score(rejected, nil, contents)
+	require.NoError(t, err)
+	assert.False(t, res.Matched, "a negated pattern still rejects a scored description")
+}
+
+func TestEvaluate_Engines(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{Engine: EngineKeywords, Pattern: "some text, PATTERNS"},
+		{Engine: EngineRegex, Pattern: `Identifier : (?P<identifier>\d+)`},
+		{Engine: EngineAnyFuzzy, Pattern: "beginnign, nowhere~0"},
+		{Pattern: "Old date %{NUMBER:year}"},
+	}
+	res, err := g.Evaluate(patterns, nil, contents)
+	require.NoError(t, err)
+	assert.True(t, res.Matched)
+	assert.Equal(t, map[string]any{"identifier": "123", "year": "1970"}, res.Captures)
+
+	res, err = g.Evaluate([]Pattern{{Engine: EngineKeywords, Pattern: "some text, missing"}}, nil, contents)
+	require.NoError(t, err)
+	assert.False(t, res.Matched)
+
+	_, err = g.Evaluate([]Pattern{{Engine: "soundex", Pattern: "text"}}, nil, contents)
+	assert.ErrorContains(t, err, `unknown matching engine "soundex"`)
+}
+
+func TestIsEngine(t *testing.T) {
+	for _, e := range []string{EngineGrok, EngineRegex, EngineKeywords, EngineAnyKeywords, EngineFuzzy, EngineAnyFuzzy} {
+		assert.True(t, IsEngine(e), e)
+	}
+	assert.False(t, IsEngine("soundex"))
+}
+
+func TestFuzzyPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"Total", `T[o0]ta[l1I\|]`},
+		{"%{NUMBER:id} No", "%{NUMBER:id} N[o0]"},
+		{`(?s)Item\.\n%{INT:qty:int}`, `(?s)[l1I\|]t[e3](?:rn|m)\.\n%{INT:qty:int}`},
+		{"x+ [a-z]{2} Bo?", `x+ [a-z]{2} [B8]o?`},
+		{"(?P<ref>R)", "(?P<ref>R)"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, fuzzyPattern(tt.pattern), tt.pattern)
+	}
+}
+
+func TestSnapAnchors(t *testing.T) {
+	text := "Invoce No 1 and lnvoice No 2, Invoice No 3, Inv No 4"
+	assert.Equal(t, "Invoice No 1 and Invoice No 2, Invoice No 3, Inv No 4",
+		snapAnchors("%{WORD} Invoice No %{INT:n}", text, 1, true))
+	assert.Equal(t, "Invoice No 1 and lnvoice No 2, Invoice No 3, Inv No 4",
+		snapAnchors("%{WORD} Invoice No %{INT:n}", text, 1, false), "first occurrence only")
+	assert.Equal(t, text, snapAnchors("Invoice No %{INT:n}", text, 0, false))
+	assert.Equal(t, "Inv 12", snapAnchors("Inv %{INT:n}", "Inv 12", 1, false), "anchor too short to snap")
+	assert.Equal(t, "Invoice abc from Invoic Corp",
+		snapAnchors("Invoice %{WORD:v} from %{GREEDYDATA:who}", "lnvoice abc from Invoic Corp", 1, false),
+		"captures are not snapped")
+}
+
+func TestEvaluate_FuzzyAnchorsBeforeCaptures(t *testing.T) {
+	g, err := New(nil)
+	require.NoError(t, err)
+
+	p := []Pattern{{Pattern: "Invoice %{WORD:v} from %{GREEDYDATA:who}", FuzzyAnchors: true, AnchorDistance: 1}}
+	res, err := g.Evaluate(p, nil, "lnvoice abc from Invoic Corp")
+	require.NoError(t, err)
+	assert.True(t, res.Matched)
+	assert.Equal(t, map[string]any{"v": "abc", "who": "Invoic Corp"}, res.Captures)
+}
+
+// corruptions are synthetic OCR errors applied to the sample invoice.
+var corruptions = []struct {
+	name     string
+	replacer *strings.Replacer
+	distance int
+}{
+	{"confusions", strings.NewReplacer("Invoice", "lnvoice", "Company", "Cornpany", "Foo", "F0o", "No 001", "N0 001"), 0},
+	{"substitutions", strings.NewReplacer("Invoice", "Invoicc", "Company Foo", "Cornpany Fo0"), 1},
+	{"deletions", strings.NewReplacer("Invoice\n", "Invoic\n", "Company", "Compny"), 1},
+}
+
+func TestEvaluate_FuzzyAnchorsOnCorruptedText(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/ykjwmwqqjhgh.txt")
+	require.NoError(t, err)
+	g, err := New(map[string]string{"MONTHS": "January|February|March"})
+	require.NoError(t, err)
+
+	patterns := []Pattern{
+		{Pattern: "Company Foo,"},
+		{Pattern: `(?s)Invoice\n\nNo %{NUMBER:invoiceNumber}\n%{MONTHS:month} %{MONTHDAY:day}, %{YEAR:year:int}`},
+	}
+	for _, c := range corruptions {
+		text := c.replacer.Replace(string(raw))
+		res, err := g.Evaluate(patterns, nil, text)
+		require.NoError(t, err, c.name)
+		assert.False(t, res.Matched, "exact anchors should fail on %s", c.name)
+
+		fuzzy := make([]Pattern, len(patterns))
+		for i, p := range patterns {
+			p.FuzzyAnchors, p.AnchorDistance = true, c.distance
+			fuzzy[i] = p
+		}
+		res, err = g.Evaluate(fuzzy, nil, text)
+		require.NoError(t, err, c.name)
+		assert.True(t, res.Matched, c.name)
+		assert.Equal(t, map[string]any{"invoiceNumber": "001", "month": "March", "day": "27", "year": int64(2014)},
+			res.Captures, c.name)
+	}
+}
+
+func TestEvaluate_FuzzyAnchorsKeepCapturesExact(t *testing.T) {
+	g, err := New(nil)
+	require.NoError(t, err)
+
+	p := []Pattern{{Pattern: "Total %{INT:total:int} EUR", FuzzyAnchors: true, AnchorDistance: 1}}
+	res, err := g.Evaluate(p, nil, "T0tal 1O0 EUR")
+	require.NoError(t, err)
+	assert.False(t, res.Matched, "OCR errors in captures are not fixed")
+
+	res, err = g.Evaluate(p, nil, "Tota1 100 EUR")
+	require.NoError(t, err)
+	assert.True(t, res.Matched)
+	assert.Equal(t, map[string]any{"total": int64(100)}, res.Captures)
+}
+
+func TestExpandAndLocate(t *testing.T) {
+	g, err := New(grokPatterns)
+	require.NoError(t, err)
+
+	expanded, err := g.Expand("Identifier : %{NUMBER:id:int}")
+	require.NoError(t, err)
+	assert.Equal(t, "Identifier : (?P<id>[0-9]+)", expanded)
+
+	spans, err := g.Locate("%{STRING:key} : %{STRING:value}", contents)
+	require.NoError(t, err)
+	require.Len(t, spans, 2)
+	assert.Equal(t, "Identifier : 123", contents[spans[0].Start:spans[0].End])
+	assert.Equal(t, []Group{{Name: "key", Start: 58, End: 68}, {Name: "value", Start: 71, End: 75}}, spans[1].Groups)
+	assert.Equal(t, "x123", contents[spans[1].Groups[1].Start:spans[1].Groups[1].End])
+
+	_, err = g.Expand("%{UNKNOWN:x}")
+	assert.Error(t, err)
+	_, err = g.Locate("%{UNKNOWN:x}", contents)
+	assert.Error(t, err)
+}
+
+func TestSuggest(t *testing.T) {
+	g, err := New(nil)
+	require.NoError(t, err)
+	const invoice = "ACME Corp\n" +
+		"Invoice\n" +
+		"No 001\n" +
+		"Date: 2014-03-27\n" +
+		"Contact: billing@example.com\n" +
+		"Item 1 12\n" +
+		"Item 2 12\n"
+
+	tests := []struct {
+		value, pattern string
+		occurrences    int
+	}{
+		{"001", "No %{NUMBER:value}", 1},
+		{"billing@example.com", "Contact: %{EMAILADDRESS:value}", 1},
+	}
+	for _, tt := range tests {
+		s, err := g.Suggest(invoice, tt.value, "value", map[string]bool{"NUMBER": true})
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, tt.pattern, s.Pattern, tt.value)
+		assert.Equal(t, tt.occurrences, s.Occurrences, tt.value)
+	}
+
+	s, err := g.Suggest(invoice, "2014-03-27", "date", nil)
+	require.NoError(t, err)
+	spans, err := g.Locate(s.Pattern, invoice)
+	require.NoError(t, err)
+	require.Len(t, spans, 1, s.Pattern)
+	assert.Equal(t, "2014-03-27", invoice[spans[0].Groups[0].Start:spans[0].Groups[len(spans[0].Groups)-1].End])
+
+	_, err = g.Suggest("12 12\n", "12", "value", nil)
+	assert.ErrorIs(t, err, ErrNoSuggestion)
+	_, err = g.Suggest(invoice, "missing", "value", nil)
+	assert.ErrorContains(t, err, "not found")
+}
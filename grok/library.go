@@ -0,0 +1,101 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package grok
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LibraryVersion is the version of the standard patterns preloaded by New. It
+// changes whenever a pattern is added, removed or its meaning changes.
+const LibraryVersion = "1.0.0"
+
+//go:embed patterns/*.grok
+var libraryFS embed.FS
+
+// patternLineRegexp matches a "NAME EXPRESSION" line of a pattern file.
+var patternLineRegexp = regexp.MustCompile(`^(\w+)\s+(.+)$`)
+
+// ReadPatterns parses a pattern file: one "NAME EXPRESSION" per line, blank
+// lines and lines starting with # are ignored. A name defined twice keeps its
+// last expression.
+func ReadPatterns(r io.Reader) (map[string]string, error) {
+	patterns := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		m := patternLineRegexp.FindStringSubmatch(text)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: expected NAME EXPRESSION, got %q", line, text)
+		}
+		patterns[m[1]] = m[2]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// Library returns the standard patterns preloaded by New.
+func Library() (map[string]string, error) {
+	files, err := fs.Glob(libraryFS, "patterns/*.grok")
+	if err != nil {
+		return nil, err
+	}
+	library := make(map[string]string)
+	for _, name := range files {
+		f, err := libraryFS.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		patterns, err := ReadPatterns(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for k, v := range patterns {
+			library[k] = v
+		}
+	}
+	return library, nil
+}
+
+// addAll registers patterns, replacing the ones that already exist. Patterns
+// may reference each other in any order: those whose references are not
+// registered yet are retried until no more progress can be made.
+func (g *Grok) addAll(patterns map[string]string) error {
+	pending := make([]string, 0, len(patterns))
+	for k := range patterns {
+		pending = append(pending, k)
+	}
+	sort.Strings(pending)
+	for len(pending) > 0 {
+		var failed []string
+		var lastErr error
+		for _, name := range pending {
+			delete(g.host, name)
+			if err := g.host.Add(name, patterns[name]); err != nil {
+				failed = append(failed, name)
+				lastErr = fmt.Errorf("grok pattern %s: %w", name, err)
+			}
+		}
+		if len(failed) == len(pending) {
+			return lastErr
+		}
+		pending = failed
+	}
+	return nil
+}
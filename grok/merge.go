@@ -0,0 +1,129 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package grok
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+// MergePolicy tells how the captures of a field found by several patterns of a
+// description are merged.
+type MergePolicy string
+
+const (
+	// MergeLast keeps the value of the last pattern (the default).
+	MergeLast MergePolicy = "last"
+	// MergeFirst keeps the value of the first pattern.
+	MergeFirst MergePolicy = "first"
+	// MergeMustEqual rejects the description when two values differ.
+	MergeMustEqual MergePolicy = "must-equal"
+	// MergeList collects every value in a list.
+	MergeList MergePolicy = "list"
+)
+
+// ParseMergePolicy validates a merge policy name.
+func ParseMergePolicy(s string) (MergePolicy, error) {
+	switch p := MergePolicy(s); p {
+	case MergeLast, MergeFirst, MergeMustEqual, MergeList:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown merge policy %q (first, last, must-equal or list)", s)
+	}
+}
+
+// fieldNameRegexp extracts the field name of %{PATTERN:field} and of typed
+// %{PATTERN:field:type} captures.
+var fieldNameRegexp = regexp.MustCompile(`%\{\w+:(\w+)`)
+
+// groupNameRegexp extracts the names of the named groups of a regex pattern.
+var groupNameRegexp = regexp.MustCompile(`\(\?P?<(\w+)>`)
+
+// Fields returns the capture names that the entry can contribute to the
+// captures of its description. Negated and findAll entries contribute none.
+func (p Pattern) Fields() []string {
+	set := make(map[string]struct{})
+	switch {
+	case p.Negate || p.FindAll != "":
+	case len(p.AllOf) > 0 || len(p.AnyOf) > 0:
+		for _, child := range append(append([]Pattern{}, p.AllOf...), p.AnyOf...) {
+			for _, f := range child.Fields() {
+				set[f] = struct{}{}
+			}
+		}
+	case p.Engine == EngineRegex:
+		for _, m := range groupNameRegexp.FindAllStringSubmatch(p.Pattern, -1) {
+			set[m[1]] = struct{}{}
+		}
+	case p.Engine == "" || p.Engine == EngineGrok:
+		for _, m := range fieldNameRegexp.FindAllStringSubmatch(p.Pattern, -1) {
+			set[m[1]] = struct{}{}
+		}
+	}
+	return sortedKeys(set)
+}
+
+// Conflicts returns, sorted, the capture names declared by more than one entry
+// of the same pattern list, including the lists nested in groups. Alternatives
+// of an anyOf group do not conflict with each other since only one is kept.
+func Conflicts(patterns []Pattern) []string {
+	count := make(map[string]int)
+	set := make(map[string]struct{})
+	for _, p := range patterns {
+		for _, f := range p.Fields() {
+			count[f]++
+			if count[f] > 1 {
+				set[f] = struct{}{}
+			}
+		}
+		nested := [][]Pattern{p.AllOf}
+		for _, alt := range p.AnyOf {
+			nested = append(nested, []Pattern{alt})
+		}
+		for _, list := range nested {
+			for _, f := range Conflicts(list) {
+				set[f] = struct{}{}
+			}
+		}
+	}
+	return sortedKeys(set)
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mergeCapture stores v under k according to the policy of k. It returns false
+// when a must-equal field receives a different value.
+func mergeCapture(captures map[string]any, policies map[string]MergePolicy, k string, v any) bool {
+	old, exists := captures[k]
+	switch policies[k] {
+	case MergeFirst:
+		if !exists {
+			captures[k] = v
+		}
+	case MergeMustEqual:
+		if exists && !reflect.DeepEqual(old, v) {
+			return false
+		}
+		captures[k] = v
+	case MergeList:
+		list, _ := old.([]any)
+		if values, ok := v.([]any); ok {
+			captures[k] = append(list, values...)
+		} else {
+			captures[k] = append(list, v)
+		}
+	default:
+		captures[k] = v
+	}
+	return true
+}
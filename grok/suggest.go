@@ -0,0 +1,285 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Suggestion is a pattern inferred from an example value found in a text.
+type Suggestion struct {
+	Pattern     string
+	Occurrences int
+}
+
+// ErrNoSuggestion is returned by Suggest when no pattern matches the value
+// uniquely.
+var ErrNoSuggestion = errors.New("no pattern matches the value uniquely")
+
+// MaxAnchorLines is the number of anchors Suggest tries among the words before
+// a value and among the lines above it. MaxAnchorDistance is how many lines
+// above the value it looks into.
+const (
+	MaxAnchorLines    = 3
+	MaxAnchorDistance = 10
+)
+
+// Suggest infers a pattern capturing value as name from an occurrence of the
+// value in text. The value is matched with the most specific patterns of the
+// host, preferring the preferred ones on a tie, and anchored on the literal
+// text that precedes it, so that the pattern matches exactly once.
+func (g *Grok) Suggest(text, value, name string, preferred map[string]bool) (Suggestion, error) {
+	var occurrences []int
+	for i := strings.Index(text, value); i >= 0 && value != ""; {
+		occurrences = append(occurrences, i)
+		next := strings.Index(text[i+len(value):], value)
+		if next < 0 {
+			break
+		}
+		i += len(value) + next
+	}
+	if len(occurrences) == 0 {
+		return Suggestion{}, fmt.Errorf("value %q not found in the text", value)
+	}
+	s := suggester{g: g, preferred: preferred, probes: probes(text)}
+	if err := s.compileCandidates(); err != nil {
+		return Suggestion{}, err
+	}
+	valuePattern := s.valuePattern(value, name)
+	for _, start := range occurrences {
+		for _, anchor := range anchors(text, start) {
+			pattern := anchor + valuePattern
+			spans, err := g.Locate(pattern, text)
+			if err != nil {
+				return Suggestion{}, err
+			}
+			if len(spans) == 1 && spans[0].End == start+len(value) {
+				return Suggestion{Pattern: pattern, Occurrences: len(occurrences)}, nil
+			}
+		}
+	}
+	return Suggestion{Occurrences: len(occurrences)}, fmt.Errorf("%w: %q", ErrNoSuggestion, value)
+}
+
+// suggester ranks the patterns of a host by how specific they are: the fewer
+// of the probes a pattern matches, the more specific it is.
+type suggester struct {
+	g          *Grok
+	preferred  map[string]bool
+	probes     []string
+	candidates []candidate
+}
+
+type candidate struct {
+	name    string
+	re      *regexp.Regexp
+	matches int
+}
+
+// technicalPatterns are the library patterns meant for logs rather than
+// documents, which Suggest never proposes.
+var technicalPatterns = map[string]bool{
+	"BASE16NUM": true, "EMAILLOCALPART": true, "HOSTNAME": true, "HOSTPORT": true, "IPORHOST": true,
+	"ISO8601_TIMEZONE": true, "PATH": true, "QS": true, "QUOTEDSTRING": true, "SPACE": true, "TZ": true,
+	"UNIXPATH": true, "USER": true, "USERNAME": true, "WINPATH": true,
+}
+
+// MaxWholeValueRatio is the share of the probes above which a pattern is too
+// generic to capture a value made of several parts at once.
+const MaxWholeValueRatio = 0.1
+
+func (s *suggester) compileCandidates() error {
+	names := make([]string, 0, len(s.g.host))
+	for name := range s.g.host {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if technicalPatterns[name] || strings.HasPrefix(name, "URI") {
+			continue
+		}
+		expanded, err := s.g.Expand("%{" + name + "}")
+		if err != nil {
+			return err
+		}
+		re, err := regexp.Compile("^(?:" + expanded + ")$")
+		if err != nil {
+			return err
+		}
+		c := candidate{name: name, re: re}
+		for _, p := range s.probes {
+			if re.MatchString(p) {
+				c.matches++
+			}
+		}
+		s.candidates = append(s.candidates, c)
+	}
+	return nil
+}
+
+// best returns the most specific pattern matching the whole of v.
+func (s *suggester) best(v string) (candidate, bool) {
+	var best candidate
+	found := false
+	for _, c := range s.candidates {
+		if !c.re.MatchString(v) {
+			continue
+		}
+		if !found || c.matches < best.matches ||
+			(c.matches == best.matches && s.preferred[c.name] && !s.preferred[best.name]) {
+			best, found = c, true
+		}
+	}
+	return best, found
+}
+
+// valuePattern returns the pattern of the value: a single capture when one
+// specific pattern matches it, or else one capture per letter or digit run,
+// separated by the literal punctuation of the value.
+func (s *suggester) valuePattern(value, name string) string {
+	tokens := tokenize(value)
+	if c, ok := s.best(value); ok && (len(tokens) == 1 || float64(c.matches) <= MaxWholeValueRatio*float64(len(s.probes))) {
+		return "%{" + c.name + ":" + name + "}"
+	}
+	var b strings.Builder
+	used := make(map[string]bool)
+	parts := 0
+	for _, t := range tokens {
+		c, ok := s.best(t)
+		if !ok || !isWordOrNumber(t) {
+			b.WriteString(regexp.QuoteMeta(t))
+			continue
+		}
+		field := name + partName(c.name)
+		if used[field] || strings.HasSuffix(field, "Part") {
+			parts++
+			field = name + "Part" + strconv.Itoa(parts)
+		}
+		used[field] = true
+		b.WriteString("%{" + c.name + ":" + field + "}")
+	}
+	return b.String()
+}
+
+// partName names a part of a value after the pattern that matched it.
+func partName(pattern string) string {
+	switch {
+	case strings.Contains(pattern, "YEAR"):
+		return "Year"
+	case strings.Contains(pattern, "MONTHDAY"), strings.HasPrefix(pattern, "DAY"):
+		return "Day"
+	case strings.Contains(pattern, "MONTH"):
+		return "Month"
+	default:
+		return "Part"
+	}
+}
+
+// tokenize cuts a value into runs of letters, runs of digits and runs of
+// anything else.
+func tokenize(value string) []string {
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r):
+			return 1
+		case unicode.IsDigit(r):
+			return 2 //nolint:mnd
+		default:
+			return 0
+		}
+	}
+	var tokens []string
+	start := 0
+	runes := []rune(value)
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || class(runes[i]) != class(runes[start]) {
+			tokens = append(tokens, string(runes[start:i]))
+			start = i
+		}
+	}
+	return tokens
+}
+
+func isWordOrNumber(t string) bool {
+	r := []rune(t)[0]
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+var (
+	probeRegexp = regexp.MustCompile(`[\p{L}\p{N}]+|\S+`)
+	wordRegexp  = regexp.MustCompile(`\S+\s*`)
+)
+
+// probes returns the strings that the specificity of patterns is measured
+// on: the words and numbers of the text, small numbers, and years.
+func probes(text string) []string {
+	set := make(map[string]struct{})
+	for _, p := range probeRegexp.FindAllString(text, -1) {
+		set[p] = struct{}{}
+	}
+	for i := range 400 {
+		set[strconv.Itoa(i)] = struct{}{}
+		set[fmt.Sprintf("%02d", i%100)] = struct{}{}
+	}
+	for y := 1900; y <= 2100; y++ {
+		set[strconv.Itoa(y)] = struct{}{}
+	}
+	list := make([]string, 0, len(set))
+	for p := range set {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// anchors returns the candidate literal anchors for a value starting at
+// start, shortest first: the last words before the value on its line, then
+// the nearest lines above it that hold no digit, which could change from one
+// document to the next. No anchor at all is the last resort.
+func anchors(text string, start int) []string {
+	lineStart := strings.LastIndexByte(text[:start], '\n') + 1
+	prefix := text[lineStart:start]
+	var list []string
+	words := wordRegexp.FindAllStringIndex(prefix, -1)
+	for k := 1; k <= len(words) && k <= MaxAnchorLines; k++ {
+		anchor := prefix[words[len(words)-k][0]:]
+		if !strings.ContainsFunc(anchor, unicode.IsDigit) {
+			list = append(list, quoteLiteral(anchor))
+		}
+	}
+	linePrefix := quoteLiteral(prefix)
+	if strings.ContainsFunc(prefix, unicode.IsDigit) {
+		linePrefix = ".*"
+	}
+	lines := strings.Split(text[:lineStart], "\n")
+	found := 0
+	for i := len(lines) - 2; i >= 0 && found < MaxAnchorLines && len(lines)-2-i < MaxAnchorDistance; i-- {
+		line := lines[i]
+		if !strings.ContainsFunc(line, unicode.IsLetter) || strings.ContainsFunc(line, unicode.IsDigit) {
+			continue
+		}
+		found++
+		between := len(lines) - 2 - i
+		anchor := quoteLiteral(line) + `\n`
+		if between > 0 {
+			anchor += fmt.Sprintf(`(?:.*\n){%d}`, between)
+		}
+		list = append(list, anchor+linePrefix)
+	}
+	if strings.TrimSpace(prefix) == "" {
+		list = append(list, "")
+	}
+	return list
+}
+
+// quoteLiteral escapes text for use in a pattern, line breaks as \n.
+func quoteLiteral(text string) string {
+	return strings.ReplaceAll(regexp.QuoteMeta(text), "\n", `\n`)
+}
@@ -0,0 +1,127 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileganizer/amounts"
+	"fileganizer/dates"
+)
+
+// ConversionPolicy tells what to do when a typed capture cannot be converted.
+type ConversionPolicy int
+
+const (
+	// ConversionNoMatch treats a conversion failure as if the pattern did not match.
+	ConversionNoMatch ConversionPolicy = iota
+	// ConversionError makes the conversion failure an error.
+	ConversionError
+)
+
+// ErrConversion is wrapped by the errors reported for typed captures that
+// cannot be converted.
+var ErrConversion = errors.New("typed capture conversion failed")
+
+// typedFieldRegexp matches Logstash-style typed captures such as
+// %{NUMBER:total:float}, %{DATE:issued:date(02/01/2006)} or
+// %{MONEY:total:amount}.
+var typedFieldRegexp = regexp.MustCompile(`%\{(\w+):(\w+):(\w+)(?:\(([^)]*)\))?\}`)
+
+// defaultDateLayouts are tried in order for a date capture without a layout
+// that the date parser of the Grok does not understand.
+var defaultDateLayouts = []string{"2006-01-02", "02/01/2006", "2006/01/02", "02.01.2006", time.RFC3339}
+
+// conversion describes the type of a single capture.
+type conversion struct {
+	kind   string
+	layout string
+}
+
+// stripTypes removes the type suffixes from a grok pattern so that it can be
+// compiled, and returns the conversion to apply to each typed field.
+func stripTypes(grokPattern string) (string, map[string]conversion, error) {
+	conversions := make(map[string]conversion)
+	var err error
+	stripped := typedFieldRegexp.ReplaceAllStringFunc(grokPattern, func(m string) string {
+		sm := typedFieldRegexp.FindStringSubmatch(m)
+		c := conversion{kind: sm[3], layout: sm[4]}
+		switch c.kind {
+		case "int", "float", "bool", "date", "amount", "string":
+		default:
+			err = fmt.Errorf("unknown type %q for field %q", c.kind, sm[2])
+		}
+		conversions[sm[2]] = c
+		return "%{" + sm[1] + ":" + sm[2] + "}"
+	})
+	return stripped, conversions, err
+}
+
+// parsers read the date and amount captures.
+type parsers struct {
+	dates   dates.Parser
+	amounts amounts.Parser
+}
+
+// convert turns the raw captured text into a value of the conversion type.
+// Dates without a layout are read with the date parser first, so that month
+// names and the configured order of numeric dates are understood. Amounts are
+// read with the decimal convention and the default currency of the amount
+// parser.
+func (c conversion) convert(raw string, p parsers) (any, error) {
+	v := strings.TrimSpace(raw)
+	switch c.kind {
+	case "int":
+		return strconv.ParseInt(v, 10, 64)
+	case "float":
+		return strconv.ParseFloat(v, 64)
+	case "bool":
+		return strconv.ParseBool(v)
+	case "date":
+		if c.layout != "" {
+			return time.Parse(c.layout, v)
+		}
+		if t, err := p.dates.Parse(v); err == nil {
+			return t, nil
+		}
+		for _, layout := range defaultDateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("no known date layout for %q", v)
+	case "amount":
+		return p.amounts.Parse(v)
+	default:
+		return raw, nil
+	}
+}
+
+// convertAll applies the conversions to the raw captures of one match. A typed
+// capture that captured nothing, such as one in an optional group that did not
+// take part in the match, is left out rather than failing its conversion.
+func convertAll(raw map[string]string, conversions map[string]conversion, p parsers) (map[string]any, error) {
+	result := make(map[string]any, len(raw))
+	for k, v := range raw {
+		c, ok := conversions[k]
+		if !ok {
+			result[k] = v
+			continue
+		}
+		if strings.TrimSpace(v) == "" && c.kind != "string" {
+			continue
+		}
+		typed, err := c.convert(v, p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %s (%s): %w", ErrConversion, k, c.kind, err)
+		}
+		result[k] = typed
+	}
+	return result, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"fileganizer/config"
+	"fileganizer/grok"
+	"fileganizer/textextract"
+)
+
+// stdin is where interactive subcommands read their input from.
+var stdin io.Reader = os.Stdin
+
+const grokDebugHelp = `Type a grok pattern to try it on the text, or a command:
+  :history            list the patterns tried
+  !!                  try the last pattern again
+  !N                  try pattern N of the history again
+  :save DESCRIPTION   append the last pattern to a file description of the configuration
+  :help               show this help
+  :quit               leave (or Ctrl-D)
+`
+
+// runGrokDebug implements the grok-debug subcommand: it loads the
+// configuration and the extracted text of the file, then lets the user try
+// patterns at a prompt.
+func runGrokDebug(ctx context.Context, args []string) error {
+	cfg, err := config.NewFromArgs(Version, args)
+	if err != nil {
+		if errors.Is(err, config.ErrVersionRequested) {
+			return nil
+		}
+		return err
+	}
+	txt, err := textextract.TextExtract(ctx, cfg.InputFile, cfg.ExtractTextCommand)
+	if err != nil {
+		return err
+	}
+	g, err := newGrok(&cfg)
+	if err != nil {
+		return err
+	}
+	d := grokDebugger{
+		g:          &g,
+		text:       txt,
+		configFile: cfg.ConfigFile,
+		out:        os.Stdout,
+		color:      isTerminal(os.Stdout),
+	}
+	return d.loop(stdin)
+}
+
+// grokDebugger holds the state of an interactive grok-debug session.
+type grokDebugger struct {
+	g          *grok.Grok
+	text       string
+	configFile string
+	out        io.Writer
+	color      bool
+	history    []string
+}
+
+func (d *grokDebugger) loop(in io.Reader) error {
+	fmt.Fprint(d.out, grokDebugHelp)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(d.out, "grok> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == ":quit" || line == ":q" {
+			return nil
+		}
+		d.command(line)
+	}
+}
+
+func (d *grokDebugger) command(line string) {
+	switch {
+	case line == "":
+	case line == ":help":
+		fmt.Fprint(d.out, grokDebugHelp)
+	case line == ":history":
+		for i, p := range d.history {
+			fmt.Fprintf(d.out, "%4d  %s\n", i+1, p)
+		}
+	case strings.HasPrefix(line, ":save"):
+		d.save(strings.TrimSpace(strings.TrimPrefix(line, ":save")))
+	case strings.HasPrefix(line, "!"):
+		p, err := d.recall(line[1:])
+		if err != nil {
+			fmt.Fprintf(d.out, "error: %v\n", err)
+			return
+		}
+		fmt.Fprintln(d.out, p)
+		d.try(p)
+	default:
+		d.try(line)
+	}
+}
+
+// recall returns the pattern of the history referenced by "!" or "!N".
+func (d *grokDebugger) recall(ref string) (string, error) {
+	if len(d.history) == 0 {
+		return "", errors.New("the history is empty")
+	}
+	if ref == "!" {
+		return d.history[len(d.history)-1], nil
+	}
+	n, err := strconv.Atoi(ref)
+	if err != nil || n < 1 || n > len(d.history) {
+		return "", fmt.Errorf("no pattern %q in the history", ref)
+	}
+	return d.history[n-1], nil
+}
+
+func (d *grokDebugger) save(description string) {
+	switch {
+	case description == "":
+		fmt.Fprintln(d.out, "error: usage: :save DESCRIPTION")
+	case len(d.history) == 0:
+		fmt.Fprintln(d.out, "error: no pattern to save")
+	default:
+		p := d.history[len(d.history)-1]
+		if err := config.AppendPattern(d.configFile, description, p); err != nil {
+			fmt.Fprintf(d.out, "error: %v\n", err)
+			return
+		}
+		fmt.Fprintf(d.out, "appended %q to %s in %s\n", p, description, d.configFile)
+	}
+}
+
+// try shows the expanded regex of a pattern, then each match with its
+// captures and where it is in the text.
+func (d *grokDebugger) try(pattern string) {
+	d.history = append(d.history, pattern)
+	expanded, err := d.g.Expand(pattern)
+	if err != nil {
+		fmt.Fprintf(d.out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(d.out, "regex: %s\n", expanded)
+	spans, err := d.g.Locate(pattern, d.text)
+	if err != nil {
+		fmt.Fprintf(d.out, "error: %v\n", err)
+		return
+	}
+	if len(spans) == 0 {
+		fmt.Fprintln(d.out, "no match")
+		return
+	}
+	for i, s := range spans {
+		fmt.Fprintf(d.out, "match %d, line %d:\n", i+1, strings.Count(d.text[:s.Start], "\n")+1)
+		d.highlight(s)
+		for _, c := range s.Groups {
+			fmt.Fprintf(d.out, "  %s = %q\n", c.Name, d.text[c.Start:c.End])
+		}
+	}
+}
+
+// highlight prints the lines of text around a span, with the span marked.
+func (d *grokDebugger) highlight(s grok.Span) {
+	begin, end := "»", "«"
+	if d.color {
+		begin, end = "\x1b[7m", "\x1b[0m"
+	}
+	lineStart := strings.LastIndexByte(d.text[:s.Start], '\n') + 1
+	lineEnd := len(d.text)
+	if i := strings.IndexByte(d.text[s.End:], '\n'); i >= 0 {
+		lineEnd = s.End + i
+	}
+	marked := d.text[lineStart:s.Start] + begin + d.text[s.Start:s.End] + end + d.text[s.End:lineEnd]
+	for _, line := range strings.Split(marked, "\n") {
+		fmt.Fprintf(d.out, "  | %s\n", line)
+	}
+}
+
+// isTerminal reports whether f is a character device, such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,96 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+
+	"fileganizer/config"
+	"fileganizer/output"
+)
+
+// hookEvents are the events with hooks, in the order they are defined.
+var hookEvents = []string{config.HookOnMatch, config.HookOnNoMatch, config.HookOnError, config.HookAfterRun}
+
+// hooks returns the hooks of an event: the ones of a description, or the
+// global ones when fd is nil, which are run with the global exec settings and
+// template errors policy.
+func hooks(cfg *config.Config, fd *config.FileDescription, event string) stepList {
+	if fd == nil {
+		return stepList{event: event, steps: cfg.Hooks.Steps(event), exec: cfg.Exec, templateErrors: cfg.TemplateErrors}
+	}
+	return stepList{fd: fd, event: event, steps: fd.Hooks.Steps(event), exec: fd.Exec, templateErrors: fd.TemplateErrors}
+}
+
+// defineHooks parses the templates of the global hooks and of the hooks of
+// the descriptions and of the fallback.
+func defineHooks(o *output.Output, cfg *config.Config) {
+	for _, event := range hookEvents {
+		defineSteps(o, hooks(cfg, nil, event))
+		for i := range cfg.FileDescriptions {
+			defineSteps(o, hooks(cfg, &cfg.FileDescriptions[i], event))
+		}
+		if cfg.Fallback != nil {
+			defineSteps(o, hooks(cfg, cfg.Fallback, event))
+		}
+	}
+}
+
+// runLists runs lists of steps in order, and stops at the first that fails.
+func runLists(ctx context.Context, cfg *config.Config, o *output.Output, values map[string]any, lists ...stepList) error {
+	for _, l := range lists {
+		if err := runSteps(ctx, cfg, o, l, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runValues returns the variables of the hooks that are not about a
+// description: onNoMatch and the global afterRun ones.
+func runValues(cfg *config.Config, matched []string) map[string]any {
+	return map[string]any{
+		"env":              cfg.EnvVars,
+		"filename":         cfg.InputFile,
+		"fileDescriptions": matched,
+	}
+}
+
+// failed runs the onError hooks of a description, then the global ones, with
+// the error in .error, and returns err along with the errors of the hooks.
+func failed(ctx context.Context, cfg *config.Config, o *output.Output, fd *config.FileDescription, values map[string]any,
+	err error,
+) error {
+	values = maps.Clone(values)
+	values["error"] = errorValues(fd, err)
+	hookErr := runLists(ctx, cfg, o, values, hooks(cfg, fd, config.HookOnError), hooks(cfg, nil, config.HookOnError))
+	if hookErr != nil {
+		return errors.Join(err, hookErr)
+	}
+	return err
+}
+
+// errorValues returns the details of an error given to the onError hooks: its
+// message, the description, and the step that failed with the exit code and
+// the output of its command, when it is known.
+func errorValues(fd *config.FileDescription, err error) map[string]any {
+	values := map[string]any{
+		"message":         err.Error(),
+		"fileDescription": fd.Name,
+		"step":            "",
+		"exitCode":        -1,
+		"stdout":          "",
+		"stderr":          "",
+	}
+	var f failedStep
+	if errors.As(err, &f) {
+		values["step"] = f.name
+		if f.result.command {
+			values["exitCode"], values["stdout"], values["stderr"] = f.result.exitCode, f.result.stdout, f.result.stderr
+		}
+	}
+	return values
+}
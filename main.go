@@ -9,10 +9,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
+	"time"
 
 	"fileganizer/config"
+	"fileganizer/filter"
 	"fileganizer/grok"
 	"fileganizer/logger"
 	"fileganizer/output"
@@ -26,15 +27,70 @@ var (
 	version string
 )
 
+// Exit codes of fileganizer, besides 0 when all went well.
+const (
+	exitFailure       = 1
+	exitUnmatched     = 2
+	exitActionsFailed = 3
+	exitConfig        = 4
+)
+
+// Sentinel errors telling why a run failed, each with its own exit code.
+var (
+	errUnmatched     = errors.New("no file description matched")
+	errActionsFailed = errors.New("actions failed")
+	errConfig        = errors.New("invalid configuration")
+)
+
+// runError is an error of a run marked with the sentinel error of its kind.
+// Its message is the one of the error itself.
+type runError struct {
+	kind error
+	err  error
+}
+
+func (e runError) Error() string {
+	return e.err.Error()
+}
+
+func (e runError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// exitCode returns the exit code for the error returned by run.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errConfig):
+		return exitConfig
+	case errors.Is(err, errActionsFailed):
+		return exitActionsFailed
+	case errors.Is(err, errUnmatched):
+		return exitUnmatched
+	default:
+		return exitFailure
+	}
+}
+
 func run() error {
 	ctx := context.Background()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "grok-debug":
+			return runGrokDebug(ctx, os.Args[2:])
+		case "suggest":
+			return runSuggest(ctx, os.Args[2:])
+		}
+	}
+
 	cfg, err := config.New(Version)
 	if err != nil {
 		if errors.Is(err, config.ErrVersionRequested) {
 			return nil
 		}
-		return err
+		return runError{errConfig, err}
 	}
 
 	txt, err := textextract.TextExtract(ctx, cfg.InputFile, cfg.ExtractTextCommand)
@@ -45,49 +101,202 @@ func run() error {
 		fmt.Printf("%v\n", txt)
 		return nil
 	}
-	return processFileDescriptions(ctx, &cfg, txt)
+	if cfg.Explain {
+		return explainFileDescriptions(&cfg, txt)
+	}
+	if cfg.Report == "" {
+		return processFileDescriptions(ctx, &cfg, txt)
+	}
+	r := &report{File: cfg.InputFile, DryRun: !cfg.NoDryRun}
+	err = processFileDescriptions(withReport(ctx, r), &cfg, txt)
+	if reportErr := r.write(cfg.Report, err); reportErr != nil {
+		return errors.Join(err, fmt.Errorf("report: %w", reportErr))
+	}
+	return err
 }
 
-func processFileDescriptions(ctx context.Context, cfg *config.Config, txt string) error {
+func newGrok(cfg *config.Config) (grok.Grok, error) {
 	g, err := grok.New(cfg.GrokPatterns)
 	if err != nil {
-		return err
+		return g, err
 	}
-	o := output.New(cfg.CommonTemplate, cfg.Months)
-	for _, fd := range cfg.FileDescriptions {
-		r, err := g.ParseAll(fd.Patterns, txt)
-		if err != nil {
-			return err
-		}
-		if r == nil {
+	g.Conversion = cfg.ConversionPolicy
+	g.Dates.Months = cfg.Months
+	g.Amounts = cfg.Amounts
+	return g, nil
+}
+
+// evaluation is the outcome of matching one file description against the
+// text. Selected descriptions are the ones whose output is rendered.
+type evaluation struct {
+	fd       *config.FileDescription
+	res      grok.Result
+	selected bool
+}
+
+// evaluateFileDescriptions matches every file description against the text.
+// Descriptions without a threshold are selected when they match. Among the
+// scored descriptions that reach their threshold, only the best one is
+// selected; the first one wins a tie.
+func evaluateFileDescriptions(g *grok.Grok, cfg *config.Config, txt string) ([]evaluation, error) {
+	evals := make([]evaluation, 0, len(cfg.FileDescriptions))
+	best := -1
+	for i := range cfg.FileDescriptions {
+		fd := &cfg.FileDescriptions[i]
+		g.Dates.Order = fd.DateOrder
+		g.Amounts.Decimal = fd.Decimal
+		if fd.Threshold == 0 {
+			res, err := g.Evaluate(fd.Patterns, fd.Merge, txt)
+			if err != nil {
+				return nil, err
+			}
+			evals = append(evals, evaluation{fd: fd, res: res, selected: res.Matched})
 			continue
 		}
-		values := map[string]any{
-			"env":      cfg.EnvVars,
-			"grok":     r,
-			"filename": cfg.InputFile,
-		}
-		outputResult, err := o.FromTemplate(fd.Output, values)
+		res, err := g.Score(fd.Patterns, fd.Merge, txt)
 		if err != nil {
-			logger.Get().Debug("Silently skipping template", "output", fd.Output, "error", err)
+			return nil, err
+		}
+		if res.Matched && res.Score >= fd.Threshold && (best < 0 || res.Score > evals[best].res.Score) {
+			best = len(evals)
+		}
+		evals = append(evals, evaluation{fd: fd, res: res})
+	}
+	if best >= 0 {
+		evals[best].selected = true
+	}
+	return evals, nil
+}
+
+// hitsValue exposes the top-level pattern hits to templates as .hits.
+func hitsValue(hits []grok.Hit) []map[string]any {
+	values := make([]map[string]any, 0, len(hits))
+	for _, h := range hits {
+		values = append(values, map[string]any{
+			"pattern": h.Pattern.String(),
+			"found":   h.Found,
+			"weight":  h.Pattern.Weight,
+		})
+	}
+	return values
+}
+
+// templateValues returns the variables of the output template of a selected
+// description: its captures, filtered then sanitized when asked, and the
+// context of the run.
+func templateValues(cfg *config.Config, e evaluation) (map[string]any, error) {
+	captures, err := filter.Apply(e.res.Captures, e.fd.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("file description %s: %w", e.fd.Name, err)
+	}
+	lists := e.res.Lists
+	if e.fd.Sanitize {
+		captures, lists = cfg.Sanitize.Values(captures), cfg.Sanitize.Lists(lists)
+	}
+	return map[string]any{
+		"env":             cfg.EnvVars,
+		"grok":            captures,
+		"grokAll":         lists,
+		"score":           e.res.Score,
+		"hits":            hitsValue(e.res.Hits),
+		"filename":        cfg.InputFile,
+		"fileDescription": e.fd.Name,
+	}, nil
+}
+
+// newOutput parses the templates once: the common template and the template
+// files, which must be valid, then the output of each description and the
+// hooks. A description whose output does not parse is reported now and
+// skipped when it is rendered.
+func newOutput(cfg *config.Config) (output.Output, error) {
+	o := output.New(cfg.CommonTemplate, cfg.Months)
+	o.Sanitize = cfg.Sanitize
+	o.Amounts = cfg.Amounts
+	o.Strict = cfg.StrictTemplates
+	o.Location = cfg.Location
+	if !cfg.Now.IsZero() {
+		o.Clock = func() time.Time { return cfg.Now }
+	}
+	if err := o.Parse(cfg.TemplateFiles); err != nil {
+		return o, err
+	}
+	for i := range cfg.FileDescriptions {
+		defineSteps(&o, outputList(&cfg.FileDescriptions[i]))
+	}
+	if cfg.Fallback != nil {
+		defineSteps(&o, outputList(cfg.Fallback))
+	}
+	defineHooks(&o, cfg)
+	return o, nil
+}
+
+// processFileDescriptions renders and runs the outputs of the selected
+// descriptions. The first description that fails stops the run, unless
+// KeepGoing is set: then the failures are reported together at the end. The
+// fallback and the global onNoMatch hooks run when no description is
+// selected, and the global afterRun hooks when all of them succeeded.
+func processFileDescriptions(ctx context.Context, cfg *config.Config, txt string) error {
+	g, err := newGrok(cfg)
+	if err != nil {
+		return runError{errConfig, err}
+	}
+	evals, err := evaluateFileDescriptions(&g, cfg, txt)
+	if err != nil {
+		return err
+	}
+	o, err := newOutput(cfg)
+	if err != nil {
+		return runError{errConfig, err}
+	}
+	var failures []error
+	var matched []string
+	for _, e := range evals {
+		if !e.selected {
 			continue
 		}
-		if cfg.NoDryRun {
-			out, err := exec.CommandContext(ctx, "bash", "-c", outputResult).CombinedOutput()
-			fmt.Printf("%s", string(out))
-			if err != nil {
-				return err
+		matched = append(matched, e.fd.Name)
+		if err := processFileDescription(ctx, cfg, &o, e); err != nil {
+			if !cfg.KeepGoing {
+				return runError{errActionsFailed, err}
 			}
-		} else {
-			fmt.Printf("%s", outputResult)
+			logger.Get().Error("File description failed", "fileDescription", e.fd.Name, "error", err)
+			failures = append(failures, err)
 		}
 	}
+	if len(matched) == 0 {
+		return processUnmatched(ctx, cfg, &o, txt)
+	}
+	if len(failures) > 0 {
+		return runError{errActionsFailed, fmt.Errorf("%d of %d file descriptions failed:\n%w", len(failures), len(matched),
+			errors.Join(failures...))}
+	}
+	if err := runLists(ctx, cfg, &o, runValues(cfg, matched), hooks(cfg, nil, config.HookAfterRun)); err != nil {
+		return runError{errActionsFailed, err}
+	}
+	return nil
+}
+
+// processFileDescription runs the onMatch hooks of a selected description,
+// the global ones first, then its outputs and its afterRun hooks. When one of
+// them fails, its onError hooks run, then the global ones.
+func processFileDescription(ctx context.Context, cfg *config.Config, o *output.Output, e evaluation) error {
+	o.DateOrder = e.fd.DateOrder
+	o.Amounts.Decimal = e.fd.Decimal
+	values, err := templateValues(cfg, e)
+	if err != nil {
+		return failed(ctx, cfg, o, e.fd, runValues(cfg, []string{e.fd.Name}), err)
+	}
+	err = runLists(ctx, cfg, o, values, hooks(cfg, nil, config.HookOnMatch), hooks(cfg, e.fd, config.HookOnMatch),
+		outputList(e.fd), hooks(cfg, e.fd, config.HookAfterRun))
+	if err != nil {
+		return failed(ctx, cfg, o, e.fd, values, err)
+	}
 	return nil
 }
 
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
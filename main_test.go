@@ -4,11 +4,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fileganizer/config"
+	"fileganizer/output"
+	"fileganizer/sanitize"
 )
 
 func captureOutput(f func() error) (string, error) {
@@ -179,3 +190,610 @@ func TestRunVersionFlag(t *testing.T) {
 	err := run()
 	assert.NoError(t, err)
 }
+
+func TestFileOptionalAndNegatePatterns(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghOptional.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "invoice 001 po none\n")
+	assert.NotContains(t, output, "should not appear")
+}
+
+func TestRunExplainFlag(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghOptional.yaml", "-f", "testdata/ykjwmwqqjhgh.txt", "-e"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "invoice: matched\n")
+	assert.Contains(t, output, "[optional-missing] PO number")
+	assert.Contains(t, output, "[negate-absent]    DUPLICATA")
+	assert.Contains(t, output, "creditNote: not matched\n")
+	assert.Contains(t, output, "[negate-found]     Temple Bar")
+	assert.NotContains(t, output, "should not appear")
+}
+
+func TestFileAnyOfPatterns(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghAnyOf.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice 001 2014-03-27\n", output)
+}
+
+func TestRunExplainFlagWithGroups(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghAnyOf.yaml", "-f", "testdata/ykjwmwqqjhgh.txt", "-e"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "  [found]            anyOf\n")
+	assert.Contains(t, output, "    [missing]          Invoice number: %{NUMBER:invoiceNumber}\n")
+	assert.Contains(t, output, "    [found]            allOf\n")
+	assert.Contains(t, output, "      [found]            %{MONTHSENGLISH:month}")
+}
+
+func TestFileMatcherEngines(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghEngines.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice 001 2014 March 27\n", output)
+}
+
+func TestFileFuzzyAnchors(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhgh.yaml", "-f", "testdata/ykjwmwqqjhghOCR.txt"}
+	output, err := captureOutput(run)
+	assert.ErrorIs(t, err, errUnmatched)
+	assert.Equal(t, "", output, "exact anchors do not match the OCR copy")
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghOCR.yaml", "-f", "testdata/ykjwmwqqjhghOCR.txt"}
+	output, err = captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice 001\n", output)
+}
+
+func TestFileFieldFilters(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghFields.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "COMPANY_FOO none 1 2014-03-27\n", output)
+}
+
+func TestFileDates(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghDates.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice 001 2014-03-27 2014-02-01 February\n", output)
+}
+
+func TestFileNow(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghNow.yaml", "-f", "testdata/ykjwmwqqjhgh.txt",
+		"--now", "2024-03-27T14:05:06Z"}
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice 001 20240327_150506 2024-03-27T15:05:06+01:00\n", output)
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghNow.yaml", "-f", "testdata/ykjwmwqqjhgh.txt",
+		"--now", "2024-07-01 23:30:00"}
+	output, err = captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice 001 20240701_233000 2024-07-01T23:30:00+02:00\n", output)
+}
+
+func TestFileAmounts(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghAmounts.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice 1200EUR 1,200 2400 10USD 1234USD 2'500.5\n", output)
+}
+
+func TestFileSanitize(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghSanitize.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "001|Conditions de paiement_ write the sell conditions|Dublin|/archive/Dublin/001.pdf\n"+
+		"Conditions de paiement: write the sell conditions|a_b\n", output)
+}
+
+func TestFileTemplates(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghTemplates.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "inline 001\nmv testdata/ykjwmwqqjhgh.txt invoice_001_2014-03-27.pdf\n", output)
+}
+
+func TestFileStrictTemplates(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghStrict.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+	output, err := captureOutput(run)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "file description strict:")
+	assert.Contains(t, err.Error(), `map has no entry for key "vendor"`)
+	assert.NotContains(t, output, "lenient")
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghBrokenTpl.yaml", "-f", "testdata/ykjwmwqqjhgh.txt", "--strict"}
+	_, err = captureOutput(run)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "file description brokentpl:")
+}
+
+func TestFileKeepGoing(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghStrict.yaml", "-f", "testdata/ykjwmwqqjhgh.txt", "-k"}
+	output, err := captureOutput(run)
+	require.Error(t, err)
+	assert.Equal(t, "withDefault 001 none\n", output, "the descriptions after the failing one are rendered")
+	assert.Contains(t, err.Error(), "1 of 3 file descriptions failed:\nfile description strict:")
+	assert.Equal(t, exitActionsFailed, exitCode(err))
+}
+
+func TestExitCodes(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for wants, args := range map[int][]string{
+		0:                 {"-c", "testdata/config.ykjwmwqqjhgh.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"},
+		exitFailure:       {"-c", "testdata/config.ykjwmwqqjhgh.yaml", "-f", "testdata/nonexistent.txt"},
+		exitUnmatched:     {"-c", "testdata/config.ykjwmwqqjhgh.yaml", "-f", "testdata/ykjwmwqqjhghOCR.txt"},
+		exitActionsFailed: {"-c", "testdata/config.ykjwmwqqjhghRunFail.yaml", "-f", "testdata/ykjwmwqqjhgh.txt", "-r"},
+		exitConfig:        {"-c", "testdata/config.brokenregex.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"},
+	} {
+		os.Args = append([]string{"./fileganizer"}, args...)
+		_, err := captureOutput(run)
+		assert.Equal(t, wants, exitCode(err), "%v: %v", args, err)
+	}
+	_, err := captureOutput(func() error {
+		os.Args = []string{"./fileganizer", "-c", "testdata/nonexistent.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+		return run()
+	})
+	assert.ErrorIs(t, err, errConfig)
+	assert.Contains(t, err.Error(), "nonexistent.yaml", "the message is the one of the error")
+}
+
+func TestFileFindAllPatterns(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghFindAll.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "product 1\nproduct 2\nproduct 3\nproduct 4\ncount 4 last 1200 sum 2520\n", output)
+}
+
+func TestFileTypedCaptures(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghTyped.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "00001 large\n", output)
+}
+
+func TestFileMergePolicies(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghMerge.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "year 2014\n")
+	assert.Contains(t, output, "prices 15 45 \n")
+	assert.NotContains(t, output, "should not appear")
+
+	os.Args = append(os.Args, "-e")
+	output, err = captureOutput(run)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "differentNumbers: not matched (values of number disagree)\n")
+}
+
+func TestFileScoredDescriptions(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghScore.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+
+	output, err := captureOutput(run)
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice 001 score 5 missing Facture\n", output)
+
+	os.Args = append(os.Args, "-e")
+	output, err = captureOutput(run)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "invoice: matched [score 5/3]\n")
+	assert.Contains(t, output, "  [missing]          Facture (weight 2)\n")
+	assert.Contains(t, output, "receipt: not matched (outscored) [score 2/2]\n")
+	assert.Contains(t, output, "creditNote: not matched [score 1/2]\n")
+}
+
+func TestFileOutputs(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dest := t.TempDir()
+	t.Setenv("DEST", dest)
+	input := filepath.Join(dest, "in.txt")
+	content, err := os.ReadFile("testdata/ykjwmwqqjhgh.txt")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(input, content, 0o600))
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghOutputs.yaml", "-f", input}
+	output, err := captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "mkdir -p '"+dest+"/empty'\n"+
+		"cp -n '"+input+"' '"+dest+"/2014/invoice_001.txt'\n"+
+		"echo failed; false\n"+
+		"mv -n '"+input+"' '"+dest+"/2014'\n"+
+		"echo done 001 "+dest+"/2014\n"+
+		"exit 3\n", output)
+
+	os.Args = append(os.Args, "-r")
+	output, err = captureOutput(run)
+	assert.EqualError(t, err, "file description invoice, outputs[6]: command failed with exit code 3")
+	assert.Equal(t, "failed\ndone 001 "+dest+"/2014/in.txt\n", output)
+	assert.DirExists(t, filepath.Join(dest, "empty"))
+	assert.FileExists(t, filepath.Join(dest, "2014", "invoice_001.txt"))
+	assert.FileExists(t, filepath.Join(dest, "2014", "in.txt"))
+	assert.NoFileExists(t, input)
+
+	require.NoError(t, os.WriteFile(input, content, 0o600))
+	_, err = captureOutput(run)
+	assert.ErrorContains(t, err, "file description invoice, outputs[1]: "+filepath.Join(dest, "2014", "invoice_001.txt")+" already exists")
+}
+
+func TestFileNativeActionsStayInRoot(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dest := t.TempDir()
+	t.Setenv("DEST", dest)
+	t.Setenv("FILEGANIZER_SANITIZE_ROOT", filepath.Join(dest, "archive"))
+	input := filepath.Join(dest, "in.txt")
+	require.NoError(t, os.WriteFile(input, []byte("City: Dublin\n"), 0o600))
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghRoot.yaml", "-f", input, "-r"}
+	_, err := captureOutput(run)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dest, "archive", "Dublin", "in.txt"))
+
+	require.NoError(t, os.WriteFile(input, []byte("City: ../..\n"), 0o600))
+	_, err = captureOutput(run)
+	assert.ErrorIs(t, err, sanitize.ErrOutsideRoot)
+	assert.EqualError(t, err, "file description invoice, outputs[0]: path is outside of the destination root: "+filepath.Dir(dest))
+	assert.FileExists(t, input)
+}
+
+func TestFileHooks(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dest := t.TempDir()
+	t.Setenv("DEST", dest)
+	t.Setenv("FAIL", "")
+	input := filepath.Join(dest, "in.txt")
+	content, err := os.ReadFile("testdata/ykjwmwqqjhgh.txt")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(input, content, 0o600))
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghHooks.yaml", "-f", input}
+	output, err := captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "echo matched invoice\n"+
+		"echo invoice 001\n"+
+		"echo output; test -z '' || { echo oops >&2; exit 5; }\n"+
+		"echo invoice done\n"+
+		"echo indexed invoice\n", output)
+
+	os.Args = append(os.Args, "-r")
+	output, err = captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "matched invoice\ninvoice 001\noutput\ninvoice done\nindexed invoice\n", output)
+
+	t.Setenv("FAIL", "true")
+	output, err = captureOutput(run)
+	assert.EqualError(t, err, "file description invoice, outputs[0]: command failed with exit code 5: oops")
+	assert.Equal(t, exitActionsFailed, exitCode(err))
+	assert.Equal(t, "matched invoice\ninvoice 001\noutput\n"+
+		"invoice failed: file description invoice, outputs[0]: command failed with exit code 5: oops\n"+
+		"quarantined invoice invoice.outputs[0] 5 oops\n", output)
+	assert.FileExists(t, filepath.Join(dest, "quarantine", "in.txt"))
+	assert.NoFileExists(t, input)
+
+	require.NoError(t, os.WriteFile(input, []byte("nothing to see\n"), 0o600))
+	output, err = captureOutput(run)
+	assert.ErrorIs(t, err, errUnmatched)
+	assert.Equal(t, exitUnmatched, exitCode(err))
+	assert.Equal(t, "unsorted "+filepath.Join(dest, "unsorted", "in.txt")+"\n", output)
+	assert.FileExists(t, filepath.Join(dest, "unsorted", "in.txt"))
+
+	require.NoError(t, os.WriteFile(input, []byte("nothing to see\n"), 0o600))
+	_, err = captureOutput(run)
+	assert.ErrorContains(t, err, "hooks.onNoMatch[0]: "+filepath.Join(dest, "unsorted", "in.txt")+" already exists")
+	assert.Equal(t, exitActionsFailed, exitCode(err))
+}
+
+func TestFileFallback(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dest := t.TempDir()
+	t.Setenv("DEST", dest)
+	input := filepath.Join(dest, "in.txt")
+	require.NoError(t, os.WriteFile(input, []byte("Unknown  document\n\nfrom nowhere\n"), 0o600))
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghFallback.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+	output, err := captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "echo invoice 001\necho indexed invoice\n", output)
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghFallback.yaml", "-f", input, "-e"}
+	output, err = captureOutput(run)
+	require.NoError(t, err)
+	assert.Contains(t, output, "invoice: not matched\n")
+	assert.True(t, strings.HasSuffix(output, "fallback: matched\n"), output)
+
+	os.Args = os.Args[:len(os.Args)-1]
+	output, err = captureOutput(run)
+	require.NoError(t, err, "a file handled by the fallback is not an error")
+	assert.Equal(t, "echo fallback in.txt .txt 32 Unknown document from nowhere\n"+
+		"mv -n '"+input+"' '"+dest+"/unsorted/'\n"+
+		"echo unmatched "+dest+"/unsorted/in.txt\n"+
+		"echo indexed fallback\n", output)
+
+	os.Args = append(os.Args, "-r")
+	output, err = captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "fallback in.txt .txt 32 Unknown document from nowhere\nunmatched "+dest+"/unsorted/in.txt\n"+
+		"indexed fallback\n", output)
+	assert.FileExists(t, filepath.Join(dest, "unsorted", "in.txt"))
+
+	require.NoError(t, os.WriteFile(input, []byte("Unknown  document\n\nfrom nowhere\n"), 0o600))
+	_, err = captureOutput(run)
+	assert.ErrorIs(t, err, errUnmatched)
+	assert.ErrorContains(t, err, "file description fallback, outputs[1]: "+filepath.Join(dest, "unsorted", "in.txt")+" already exists")
+	assert.Equal(t, exitActionsFailed, exitCode(err))
+}
+
+func TestExcerpt(t *testing.T) {
+	assert.Equal(t, "a b c", excerpt(" a\n\n b\tc ", 10))
+	assert.Equal(t, "été d", excerpt("été  deux", 5))
+}
+
+func TestFileExec(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghExec.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+	output, err := captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "'printf' '%s|%s\n' '001 it'\\''s' '$GREETING'\n"+
+		"'sh' '-c' 'echo $GREETING 001'\n"+
+		"echo $GREETING $(basename \"$(pwd)\") 001", output)
+
+	os.Args = append(os.Args, "-r")
+	output, err = captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "001 it's|$GREETING\nhello 001\nbonjour templates 001\n", output)
+}
+
+func TestFileExecEnvironmentAndTimeout(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Setenv("SLOW", "")
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghExecEnv.yaml", "-f", "testdata/ykjwmwqqjhgh.txt", "-r"}
+	output, err := captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "001|March|2014|no home|hello\npartial\n", output)
+
+	t.Setenv("SLOW", "true")
+	start := time.Now()
+	_, err = captureOutput(run)
+	assert.EqualError(t, err, "file description invoice, outputs[2]: timed out after 200ms")
+	assert.Less(t, time.Since(start), 4*time.Second)
+}
+
+func TestFileReport(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Setenv("SLOW", "")
+	file := filepath.Join(t.TempDir(), "report.json")
+	os.Args = []string{"./fileganizer", "-c", "testdata/config.ykjwmwqqjhghExecEnv.yaml", "-f", "testdata/ykjwmwqqjhgh.txt",
+		"-r", "--report", file}
+	_, err := captureOutput(run)
+	require.NoError(t, err)
+
+	r := readReport(t, file)
+	assert.Equal(t, "testdata/ykjwmwqqjhgh.txt", r.File)
+	assert.False(t, r.DryRun)
+	assert.Equal(t, 0, r.ExitCode)
+	require.Len(t, r.Steps, 3)
+	assert.Equal(t, "invoice", r.Steps[0].FileDescription)
+	assert.Equal(t, statusDone, r.Steps[0].Status)
+	assert.Equal(t, 0, *r.Steps[0].ExitCode)
+	assert.Equal(t, "001|March|2014|no home|hello\n", r.Steps[0].Stdout)
+	assert.Equal(t, stepReport{FileDescription: "invoice", Step: 1, Action: config.ActionCommand, Status: statusFailed,
+		Command: "echo warning >&2; echo partial; exit 4", ExitCode: r.Steps[1].ExitCode, Stdout: "partial\n",
+		Stderr: "warning\n", Duration: r.Steps[1].Duration, Error: "command failed with exit code 4: warning"}, r.Steps[1])
+	assert.Equal(t, 4, *r.Steps[1].ExitCode)
+	assert.Equal(t, stepReport{FileDescription: "invoice", Step: 2, Action: config.ActionCommand, Status: statusSkipped},
+		r.Steps[2])
+
+	t.Setenv("SLOW", "true")
+	_, err = captureOutput(run)
+	require.Error(t, err)
+	r = readReport(t, file)
+	assert.Equal(t, exitActionsFailed, r.ExitCode)
+	assert.Equal(t, "file description invoice, outputs[2]: timed out after 200ms", r.Error)
+	require.Len(t, r.Steps, 3)
+	assert.Equal(t, statusFailed, r.Steps[2].Status)
+	assert.Equal(t, "timed out after 200ms", r.Steps[2].Error)
+
+	os.Args = slices.DeleteFunc(os.Args, func(arg string) bool { return arg == "-r" })
+	_, err = captureOutput(run)
+	require.NoError(t, err)
+	r = readReport(t, file)
+	assert.True(t, r.DryRun)
+	require.Len(t, r.Steps, 3)
+	assert.Equal(t, statusPrinted, r.Steps[2].Status)
+	assert.Equal(t, "sleep 5", r.Steps[2].Command)
+}
+
+func readReport(t *testing.T, file string) report {
+	t.Helper()
+	var r report
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(content, &r))
+	return r
+}
+
+func TestRenderStepPath(t *testing.T) {
+	o := output.New("", nil)
+	require.NoError(t, o.Parse(nil))
+	require.NoError(t, o.Define("block", "{{ .dir }}/2014\n"))
+	require.NoError(t, o.Define("empty", "{{ .missing }}\n"))
+	values := map[string]any{"dir": "/archive", "missing": ""}
+
+	rendered, _, err := renderStep(&o, config.DefaultExec(), "block", config.OutputStep{Action: config.ActionMove}, values)
+	require.NoError(t, err)
+	assert.Equal(t, "/archive/2014", rendered)
+	_, _, err = renderStep(&o, config.DefaultExec(), "empty", config.OutputStep{Action: config.ActionMkdir}, values)
+	assert.ErrorIs(t, err, errEmptyPath)
+	rendered, _, err = renderStep(&o, config.DefaultExec(), "block", config.OutputStep{Action: config.ActionCommand}, values)
+	require.NoError(t, err)
+	assert.Equal(t, "/archive/2014\n", rendered, "commands are kept as rendered")
+}
+
+func TestCopyFileCancelled(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.txt")
+	require.NoError(t, os.WriteFile(src, []byte("content"), 0o600))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, copyFile(ctx, src, filepath.Join(dir, "out.txt")), context.Canceled)
+	assert.NoFileExists(t, filepath.Join(dir, "out.txt"), "a partial copy is removed")
+	require.NoError(t, copyFile(context.Background(), src, filepath.Join(dir, "out.txt")))
+	assert.FileExists(t, filepath.Join(dir, "out.txt"))
+}
+
+func TestEnvName(t *testing.T) {
+	for name, wants := range map[string]string{
+		"invoiceNumber": "INVOICE_NUMBER",
+		"total":         "TOTAL",
+		"vat2Rate":      "VAT2_RATE",
+		"IBAN":          "IBAN",
+		"due-date":      "DUE_DATE",
+		"prénom":        "PR_NOM",
+	} {
+		assert.Equal(t, wants, envName(name), name)
+	}
+}
+
+func TestGrokDebug(t *testing.T) {
+	oldArgs, oldStdin := os.Args, stdin
+	defer func() { os.Args, stdin = oldArgs, oldStdin }()
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	content, err := os.ReadFile("testdata/config.ykjwmwqqjhgh.yaml")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(configFile, content, 0o600))
+
+	os.Args = []string{"./fileganizer", "grok-debug", "-c", configFile, "-f", "testdata/ykjwmwqqjhgh.txt"}
+	stdin = strings.NewReader(strings.Join([]string{
+		"%{UNKNOWN:x}",
+		`No %{NUMBER:invoiceNumber}\n%{MONTHSENGLISH:month}`,
+		"My product %{NUMBER:n}",
+		":history",
+		"!2",
+		"!9",
+		":save ykjwmwqqjhgh",
+		":quit",
+	}, "\n"))
+
+	output, err := captureOutput(run)
+	require.NoError(t, err)
+	assert.Contains(t, output, "error: the 'UNKNOWN' pattern doesn't exist\n")
+	assert.Contains(t, output, "regex: No (?P<invoiceNumber>[0-9]+)\\n(?P<month>(January|")
+	assert.Contains(t, output, "match 1, line 7:\n  | »No 001\n  | March« 27, 2014\n  invoiceNumber = \"001\"\n  month = \"March\"\n")
+	assert.Contains(t, output, "match 4, line 56:\n  | »My product 4«\n  n = \"4\"\n")
+	assert.Contains(t, output, "   3  My product %{NUMBER:n}\n")
+	assert.Contains(t, output, "error: no pattern \"9\" in the history\n")
+	assert.Contains(t, output, "appended \"No %{NUMBER:invoiceNumber}\\\\n%{MONTHSENGLISH:month}\" to ykjwmwqqjhgh")
+
+	os.Args = []string{"./fileganizer", "-c", configFile, "-f", "testdata/ykjwmwqqjhgh.txt", "-e"}
+	output, err = captureOutput(run)
+	require.NoError(t, err)
+	assert.Contains(t, output, "  [found]            No %{NUMBER:invoiceNumber}\\n%{MONTHSENGLISH:month}\n")
+}
+
+func TestSuggest(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"./fileganizer", "suggest", "-c", "testdata/config.ykjwmwqqjhgh.yaml", "-f", "testdata/ykjwmwqqjhgh.txt",
+		"--value", "001", "--name", "invoiceNumber"}
+	output, err := captureOutput(run)
+	require.NoError(t, err)
+	assert.Equal(t, "# \"001\" found 1 time(s), the pattern matches it once\n- \"No %{NUMBER:invoiceNumber}\"\n", output)
+
+	os.Args = []string{"./fileganizer", "suggest", "-c", "testdata/config.ykjwmwqqjhgh.yaml", "-f", "testdata/ykjwmwqqjhgh.txt",
+		"--value", "March 27, 2014", "--name", "date"}
+	output, err = captureOutput(run)
+	require.NoError(t, err)
+	assert.Contains(t, output, `%{DATE_ANY:date}"`)
+
+	os.Args = []string{"./fileganizer", "suggest", "-c", "testdata/config.ykjwmwqqjhgh.yaml", "-f", "testdata/ykjwmwqqjhgh.txt"}
+	_, err = captureOutput(run)
+	assert.EqualError(t, err, "--value is required")
+}
@@ -0,0 +1,187 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package matcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"fileganizer/logger"
+)
+
+// Keywords matches a comma-separated list of literal keywords, ignoring case.
+// A comma that is part of a keyword is escaped as \, and a backslash as \\.
+// All keywords must be present, or at least one when Any is set.
+type Keywords struct {
+	Any bool
+}
+
+// Match looks for the keywords of pattern in text.
+func (k Keywords) Match(pattern, text string) (map[string]any, bool, error) {
+	words, err := splitKeywords(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+	logger.Get().Debug("Testing keywords", "keywords", words, "any", k.Any)
+	lower := strings.ToLower(text)
+	found := combine(words, k.Any, func(w keyword) bool {
+		return strings.Contains(lower, strings.ToLower(w.word))
+	})
+	return map[string]any{}, found, nil
+}
+
+// Fuzzy is like Keywords but tolerates typos and OCR errors: a keyword is found
+// when some part of the text is within an edit distance of it. The distance is
+// given per keyword with Lucene's "word~N" syntax and defaults to one edit per
+// DefaultRatio runes of the keyword, with a minimum of one.
+type Fuzzy struct {
+	Any bool
+}
+
+// DefaultRatio is the number of runes of a keyword per tolerated edit when the
+// keyword does not set its distance.
+const DefaultRatio = 5
+
+// Match looks for approximate occurrences of the keywords of pattern in text.
+func (f Fuzzy) Match(pattern, text string) (map[string]any, bool, error) {
+	words, err := splitKeywords(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+	logger.Get().Debug("Testing fuzzy keywords", "keywords", words, "any", f.Any)
+	lower := []rune(strings.ToLower(text))
+	found := combine(words, f.Any, func(w keyword) bool {
+		distance := w.distance
+		if distance < 0 {
+			distance = max(1, utf8.RuneCountInString(w.word)/DefaultRatio)
+		}
+		_, _, d := Nearest([]rune(strings.ToLower(w.word)), lower)
+		return d <= distance
+	})
+	return map[string]any{}, found, nil
+}
+
+// keyword is one entry of a keyword list. distance is -1 when not set.
+type keyword struct {
+	word     string
+	distance int
+}
+
+// JoinKeywords writes a list of keywords as the pattern of the keyword
+// engines, escaping the commas and backslashes of each keyword.
+func JoinKeywords(words []string) string {
+	escaped := make([]string, 0, len(words))
+	for _, w := range words {
+		escaped = append(escaped, keywordEscaper.Replace(w))
+	}
+	return strings.Join(escaped, ", ")
+}
+
+var keywordEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`)
+
+// splitCommas splits a pattern on its commas that are not escaped, and
+// unescapes the parts.
+func splitCommas(pattern string) []string {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern) && (pattern[i+1] == ',' || pattern[i+1] == '\\'):
+			i++
+			b.WriteByte(pattern[i])
+		case c == ',':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(parts, b.String())
+}
+
+func splitKeywords(pattern string) ([]keyword, error) {
+	var words []keyword
+	for _, w := range splitCommas(pattern) {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		kw := keyword{word: w, distance: -1}
+		if i := strings.LastIndex(w, "~"); i > 0 {
+			d, err := strconv.Atoi(w[i+1:])
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid distance in keyword %q", w)
+			}
+			kw = keyword{word: w[:i], distance: d}
+		}
+		words = append(words, kw)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("no keyword in %q", pattern)
+	}
+	return words, nil
+}
+
+func combine(words []keyword, anyWord bool, found func(keyword) bool) bool {
+	for _, w := range words {
+		if found(w) == anyWord {
+			return anyWord
+		}
+	}
+	return !anyWord
+}
+
+// Nearest finds the substring of text with the smallest edit distance
+// (Levenshtein) to word. It returns the rune offsets of that substring and
+// the distance. Among equally distant substrings, the first one of the length
+// closest to the word's wins.
+func Nearest(word, text []rune) (start, end, distance int) {
+	if len(word) == 0 {
+		return 0, 0, 0
+	}
+	// prev[j] and cur[j] hold the distance between word[:i] and the best
+	// substring of text ending at j; begin tracks where that substring starts.
+	prev := make([]int, len(text)+1)
+	cur := make([]int, len(text)+1)
+	prevBegin := make([]int, len(text)+1)
+	curBegin := make([]int, len(text)+1)
+	for j := range prevBegin {
+		prevBegin[j] = j
+	}
+	for i := 1; i <= len(word); i++ {
+		cur[0], curBegin[0] = i, 0
+		for j := 1; j <= len(text); j++ {
+			cost := 1
+			if word[i-1] == text[j-1] {
+				cost = 0
+			}
+			cur[j], curBegin[j] = prev[j-1]+cost, prevBegin[j-1]
+			if prev[j]+1 < cur[j] {
+				cur[j], curBegin[j] = prev[j]+1, prevBegin[j]
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j], curBegin[j] = cur[j-1]+1, curBegin[j-1]
+			}
+		}
+		prev, cur = cur, prev
+		prevBegin, curBegin = curBegin, prevBegin
+	}
+	distance = prev[0]
+	for j := 1; j <= len(text); j++ {
+		// On a tie, prefer the substring whose length is closest to the word.
+		if prev[j] < distance || (prev[j] == distance && lengthGap(j-prevBegin[j], len(word)) < lengthGap(end-start, len(word))) {
+			distance, start, end = prev[j], prevBegin[j], j
+		}
+	}
+	return start, end, distance
+}
+
+func lengthGap(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,42 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+// Package matcher provides matching engines that can be used beside grok to
+// look for a pattern in the extracted text.
+package matcher
+
+import (
+	"regexp"
+
+	"fileganizer/logger"
+)
+
+// Matcher looks for a pattern in text. It reports whether the pattern was
+// found and returns the named captures of the match, if any.
+type Matcher interface {
+	Match(pattern, text string) (map[string]any, bool, error)
+}
+
+// Regex matches plain RE2 regular expressions. Named groups ((?P<name>...))
+// become captures.
+type Regex struct{}
+
+// Match compiles pattern as a regular expression and applies it to text.
+func (Regex) Match(pattern, text string) (map[string]any, bool, error) {
+	logger.Get().Debug("Testing regex", "pattern", pattern)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return map[string]any{}, false, nil
+	}
+	captures := make(map[string]any)
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			captures[name] = m[i]
+		}
+	}
+	return captures, true, nil
+}
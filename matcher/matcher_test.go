@@ -0,0 +1,101 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package matcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const contents = "Facture Orange, Paris\n" +
+	"Numéro client : 42\n" +
+	"Montant TTC : 31,99 EUR\n"
+
+func TestRegex(t *testing.T) {
+	r, found, err := Regex{}.Match(`client : (?P<client>\d+)`, contents)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string]any{"client": "42"}, r)
+
+	r, found, err = Regex{}.Match(`Facture \d+`, contents)
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, r)
+
+	_, _, err = Regex{}.Match(`(?P<broken`, contents)
+	assert.Error(t, err)
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []struct {
+		pattern string
+		any     bool
+		found   bool
+	}{
+		{"orange, FACTURE", false, true},
+		{"orange, free", false, false},
+		{"orange, free", true, true},
+		{"sfr, free", true, false},
+		{`orange\, paris`, false, true},
+		{`orange\, lyon, facture`, true, true},
+		{`orange\, lyon`, true, false},
+		{JoinKeywords([]string{"Orange, Paris", "Montant"}), false, true},
+		{JoinKeywords([]string{"Orange, Lyon", "Montant"}), false, false},
+	}
+	for _, tt := range tests {
+		_, found, err := Keywords{Any: tt.any}.Match(tt.pattern, contents)
+		require.NoError(t, err, tt.pattern)
+		assert.Equal(t, tt.found, found, tt.pattern)
+	}
+
+	_, _, err := Keywords{}.Match(" , ", contents)
+	assert.Error(t, err)
+}
+
+func TestSplitCommas(t *testing.T) {
+	assert.Equal(t, []string{"a", " b, c", ` d\e`, ` \f`}, splitCommas(`a, b\, c, d\\e, \f`))
+	keywords, err := splitKeywords(JoinKeywords([]string{"Orange, Paris", `C:\dir`, `\,`}))
+	require.NoError(t, err)
+	assert.Equal(t, []keyword{{"Orange, Paris", -1}, {`C:\dir`, -1}, {`\,`, -1}}, keywords)
+}
+
+func TestFuzzy(t *testing.T) {
+	const ocr = "Factnre 0range\nMontant TTC : 31,99 EUR\n"
+	tests := []struct {
+		pattern string
+		any     bool
+		found   bool
+	}{
+		{"facture, orange", false, true},
+		{"facture~0, orange", false, false},
+		{"facture~0, orange", true, true},
+		{"factures~2", false, true},
+		{"bouygues, free", true, false},
+	}
+	for _, tt := range tests {
+		_, found, err := Fuzzy{Any: tt.any}.Match(tt.pattern, ocr)
+		require.NoError(t, err, tt.pattern)
+		assert.Equal(t, tt.found, found, tt.pattern)
+	}
+
+	_, _, err := Fuzzy{}.Match("facture~x", ocr)
+	assert.Error(t, err)
+}
+
+func TestNearest(t *testing.T) {
+	text := []rune("Numéro de facfure : 12")
+	start, end, distance := Nearest([]rune("facture"), text)
+	assert.Equal(t, 1, distance)
+	assert.Equal(t, "facfure", string(text[start:end]))
+
+	_, _, distance = Nearest([]rune("Numéro"), text)
+	assert.Zero(t, distance)
+
+	text = []rune("Tota1 100")
+	start, end, distance = Nearest([]rune("Total"), text)
+	assert.Equal(t, 1, distance)
+	assert.Equal(t, "Tota1", string(text[start:end]), "ties prefer the length of the word")
+}
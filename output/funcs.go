@@ -0,0 +1,232 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package output
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"fileganizer/accents"
+)
+
+// library is the general purpose function library available in templates.
+// Like in sprig, the value a function works on comes last, so that it can be
+// piped: {{ .grok.vendor | trim | replace " " "_" }}.
+var library = template.FuncMap{
+	"replace":      func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+	"trim":         strings.TrimSpace,
+	"trimAll":      func(cutset, s string) string { return strings.Trim(s, cutset) },
+	"regexReplace": regexReplace,
+	"default":      byDefault,
+	"padLeft":      padLeft,
+	"padRight":     padRight,
+	"split":        func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":         join,
+	"title":        title,
+	"substr":       substr,
+	"add":          add,
+	"sub":          sub,
+	"mul":          mul,
+	"div":          div,
+	"mod":          mod,
+	"dateParse":    dateParse,
+	"basename":     filepath.Base,
+	"dirname":      filepath.Dir,
+	"ext":          filepath.Ext,
+	"slugify":      slugify,
+}
+
+func regexReplace(expr, replacement, s string) (string, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", fmt.Errorf("regexReplace: %w", err)
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+// byDefault returns v, or def when v is missing or empty.
+func byDefault(def, v any) any {
+	if v == nil || v == "" {
+		return def
+	}
+	return v
+}
+
+// padLeft pads the formatted value on the left with pad up to width runes:
+// {{ padLeft 5 "0" .grok.number }}.
+func padLeft(width int, pad string, v any) string {
+	s := fmt.Sprint(v)
+	return padding(width, pad, s) + s
+}
+
+// padRight pads the formatted value on the right with pad up to width runes.
+func padRight(width int, pad string, v any) string {
+	s := fmt.Sprint(v)
+	return s + padding(width, pad, s)
+}
+
+func padding(width int, pad, s string) string {
+	missing := width - utf8.RuneCountInString(s)
+	if missing <= 0 || pad == "" {
+		return ""
+	}
+	return string([]rune(strings.Repeat(pad, missing))[:missing])
+}
+
+// join joins a list of values, such as the result of split, with sep.
+func join(sep string, list any) (string, error) {
+	switch l := list.(type) {
+	case []string:
+		return strings.Join(l, sep), nil
+	case []any:
+		parts := make([]string, 0, len(l))
+		for _, v := range l {
+			parts = append(parts, fmt.Sprint(v))
+		}
+		return strings.Join(parts, sep), nil
+	default:
+		return "", fmt.Errorf("join: cannot join %T", list)
+	}
+}
+
+// title capitalizes the first letter of each word and lowers the others, so
+// that "ACME CORP" and "acme corp" both become "Acme Corp".
+func title(s string) string {
+	var b strings.Builder
+	start := true
+	for _, r := range s {
+		if start {
+			b.WriteRune(unicode.ToUpper(r))
+		} else {
+			b.WriteRune(unicode.ToLower(r))
+		}
+		start = !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}
+	return b.String()
+}
+
+// substr returns the runes of s from start to end, both clamped to the length
+// of s. A negative end stands for the end of s.
+func substr(start, end int, s string) string {
+	runes := []rune(s)
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+	start = max(0, min(start, end))
+	return string(runes[start:end])
+}
+
+// integer reports whether v holds an integer, and which.
+func integer(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// arithmetic applies an operation to two captures or numbers. The result is
+// an integer when both operands are, and a float otherwise.
+func arithmetic(name string, a, b any, ints func(x, y int64) int64, floats func(x, y float64) float64) (any, error) {
+	x, xok := integer(a)
+	y, yok := integer(b)
+	if xok && yok {
+		return ints(x, y), nil
+	}
+	fx, err := ToFloat(a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	fy, err := ToFloat(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return floats(fx, fy), nil
+}
+
+func add(a, b any) (any, error) {
+	return arithmetic("add", a, b, func(x, y int64) int64 { return x + y }, func(x, y float64) float64 { return x + y })
+}
+
+func sub(a, b any) (any, error) {
+	return arithmetic("sub", a, b, func(x, y int64) int64 { return x - y }, func(x, y float64) float64 { return x - y })
+}
+
+func mul(a, b any) (any, error) {
+	return arithmetic("mul", a, b, func(x, y int64) int64 { return x * y }, func(x, y float64) float64 { return x * y })
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+// div divides a by b. The result is always a float: {{ div .grok.cents 100 }}.
+func div(a, b any) (float64, error) {
+	x, err := ToFloat(a)
+	if err != nil {
+		return 0, fmt.Errorf("div: %w", err)
+	}
+	y, err := ToFloat(b)
+	if err != nil {
+		return 0, fmt.Errorf("div: %w", err)
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("div: %w", errDivisionByZero)
+	}
+	return x / y, nil
+}
+
+// mod returns the remainder of the integer division of a by b.
+func mod(a, b any) (int64, error) {
+	x, xok := integer(a)
+	y, yok := integer(b)
+	if !xok || !yok {
+		return 0, fmt.Errorf("mod: %v and %v must be integers", a, b)
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("mod: %w", errDivisionByZero)
+	}
+	return x % y, nil
+}
+
+// dateParse parses a date with a Go layout:
+// {{ .grok.date | dateParse "02/01/2006" }}.
+func dateParse(layout, s string) (time.Time, error) {
+	t, err := time.Parse(layout, strings.TrimSpace(s))
+	if err != nil {
+		return t, fmt.Errorf("dateParse: %w", err)
+	}
+	return t, nil
+}
+
+// slugify turns s into a lowercase ASCII identifier made of letters, digits
+// and dashes: "Société Générale, Paris" becomes "societe-generale-paris".
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(accents.Remove(s)) {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
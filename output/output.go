@@ -5,18 +5,39 @@ package output
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
+	"fileganizer/amounts"
+	"fileganizer/dates"
 	"fileganizer/logger"
+	"fileganizer/sanitize"
 )
 
 // Output holds template configuration and renders Go templates with parsed data.
+// DateOrder tells how ParseDate reads numeric dates, and Amounts how
+// ParseAmount reads amounts. Sanitize is the policy of
+// the sanitize, sanitizePath and safePath functions. In Strict mode, a template
+// using a missing field fails instead of rendering "<no value>". Clock and
+// Location give the time of the now functions, time.Now in the local timezone
+// when unset.
 type Output struct {
 	commonTemplate string
 	months         map[string][]string
+	DateOrder      dates.Order
+	Amounts        amounts.Parser
+	Sanitize       sanitize.Policy
+	Strict         bool
+	Clock          func() time.Time
+	Location       *time.Location
+	set            *template.Template
+	outputs        map[string]*template.Template
+	errors         map[string]error
 }
 
 // New creates an Output with an optional common template prefix and month mappings.
@@ -24,51 +45,300 @@ func New(tpl string, months map[string][]string) Output {
 	var o Output
 	o.commonTemplate = tpl
 	o.months = months
+	o.Sanitize = sanitize.DefaultPolicy()
 	return o
 }
 
 // MonthIndex returns the zero-padded month number (01-12) for the given month
-// name by looking it up in the configured month lists. Returns the input as-is
-// if not found.
+// name by looking it up in the configured month lists, as dates.MonthIndex
+// reads it. Returns the input as-is if not found.
 func (o Output) MonthIndex(month string) string {
-	for _, months := range o.months {
-		for i, data := range months {
-			if data == month {
-				return fmt.Sprintf("%02d", i+1)
-			}
+	index, err := dates.MonthIndex(month, o.months)
+	if err != nil {
+		return month
+	}
+	return fmt.Sprintf("%02d", index)
+}
+
+// Now returns the time of the now functions.
+func (o Output) Now() time.Time {
+	clock := o.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	if o.Location == nil {
+		return clock()
+	}
+	return clock().In(o.Location)
+}
+
+// ToFloat converts a capture to a float64. It accepts typed captures (int,
+// float) as well as strings holding a number.
+func ToFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int64:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case amounts.Amount:
+		return n.Float(), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(n), 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to a number", v)
+	}
+}
+
+// ToInt converts a capture to an int64, truncating floats.
+func ToInt(v any) (int64, error) {
+	if s, ok := v.(string); ok {
+		if i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+			return i, nil
 		}
 	}
-	return month
+	f, err := ToFloat(v)
+	return int64(f), err
 }
 
-// FromTemplate renders the output template (prefixed with CommonTemplate if set)
-// using the provided variables and returns the result as a string.
-func (o Output) FromTemplate(tmpl string, vars map[string]any) (string, error) {
-	l := logger.Get()
-	funcMap := template.FuncMap{
+// FormatDate formats a date capture with a Go layout. The date comes last so
+// that it can be piped: {{ .grok.issued | dateFormat "2006-01-02" }}.
+func FormatDate(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// DaysBetween returns the number of whole days from a to b.
+func DaysBetween(a, b time.Time) int {
+	return int(b.Sub(a).Hours() / 24) //nolint:mnd
+}
+
+// ParseDate reads a date written with a month name of the month lists or with
+// numbers, as date captures do. Dates are returned as is.
+func (o Output) ParseDate(v any) (time.Time, error) {
+	if t, ok := v.(time.Time); ok {
+		return t, nil
+	}
+	return dates.Parser{Months: o.months, Order: o.DateOrder}.Parse(fmt.Sprint(v))
+}
+
+// ParseAmount reads an amount of money with its currency, as amount captures
+// are. Amounts are returned as is, and numbers get the default currency.
+func (o Output) ParseAmount(v any) (amounts.Amount, error) {
+	switch n := v.(type) {
+	case amounts.Amount:
+		return n, nil
+	case float64:
+		return amounts.Amount{Value: strconv.FormatFloat(n, 'f', -1, 64), Currency: o.Amounts.Currency}, nil
+	case int64:
+		return amounts.Amount{Value: strconv.FormatInt(n, 10), Currency: o.Amounts.Currency}, nil
+	case int:
+		return amounts.Amount{Value: strconv.Itoa(n), Currency: o.Amounts.Currency}, nil
+	default:
+		return o.Amounts.Parse(fmt.Sprint(v))
+	}
+}
+
+// FormatAmount writes the value of an amount with the separators of a locale
+// (see amounts.Amount.Format). The amount comes last so that it can be piped:
+// {{ .grok.total | formatAmount "fr" }}.
+func (o Output) FormatAmount(locale string, v any) (string, error) {
+	a, err := o.ParseAmount(v)
+	if err != nil {
+		return "", err
+	}
+	return a.Format(locale)
+}
+
+// Sum adds up the values stored under key in each item of a list captured with
+// findAll. Items without the key are ignored.
+func Sum(items []map[string]any, key string) (float64, error) {
+	var total float64
+	for _, item := range items {
+		v, ok := item[key]
+		if !ok {
+			continue
+		}
+		f, err := ToFloat(v)
+		if err != nil {
+			return 0, fmt.Errorf("sum of %s: %w", key, err)
+		}
+		total += f
+	}
+	return total, nil
+}
+
+// Last returns the last item of a list captured with findAll, or an empty map
+// when the list is empty.
+func Last(items []map[string]any) map[string]any {
+	if len(items) == 0 {
+		return map[string]any{}
+	}
+	return items[len(items)-1]
+}
+
+// funcMap returns the functions of the templates. The functions that depend on
+// the settings of the Output are bound again before each rendering.
+func (o Output) funcMap() template.FuncMap {
+	return template.FuncMap{
 		"ToUpper":            strings.ToUpper,
 		"ToLower":            strings.ToLower,
 		"MonthIndex":         func(m string) string { return o.MonthIndex(m) }, //nolint:gocritic
-		"NowYYYY":            func() string { return time.Now().Format("2006") },
-		"NowYYYYMMDD":        func() string { return time.Now().Format("20060102") },
-		"NowYYYYMMDD_HHMMSS": func() string { return time.Now().Format("20060102_030405") },
+		"parseDate":          o.ParseDate,
+		"parseAmount":        o.ParseAmount,
+		"formatAmount":       o.FormatAmount,
+		"sanitize":           func(v any) string { return o.Sanitize.Component(fmt.Sprint(v)) },
+		"sanitizePath":       func(v any) string { return o.Sanitize.Path(fmt.Sprint(v)) },
+		"safePath":           o.Sanitize.SafePath,
+		"sum":                Sum,
+		"last":               Last,
+		"toFloat":            ToFloat,
+		"toInt":              ToInt,
+		"dateFormat":         FormatDate,
+		"daysBetween":        DaysBetween,
+		"now":                o.Now,
+		"NowYYYY":            func() string { return o.Now().Format("2006") },
+		"NowYYYYMMDD":        func() string { return o.Now().Format("20060102") },
+		"NowYYYYMMDD_HHMMSS": func() string { return o.Now().Format("20060102_150405") },
+	}
+}
+
+// Parse parses the template files once, into the template set that the
+// outputs defined afterwards can use. Template files are named after their
+// path, so that errors tell the file and the line.
+func (o *Output) Parse(files []string) error {
+	set, err := o.parseSet(files)
+	if err != nil {
+		return err
 	}
-	fullTpl := tmpl
+	o.set = set
+	o.outputs = make(map[string]*template.Template)
+	o.errors = make(map[string]error)
+	return nil
+}
+
+func (o Output) parseSet(files []string) (*template.Template, error) {
+	set := template.New("").Funcs(library).Funcs(o.funcMap())
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := set.New(f).Parse(string(content)); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// Define parses the output template of a description, prefixed with the common
+// template, in its own copy of the template set so that the templates it
+// defines do not leak into the other outputs. A parse error is returned and
+// kept, to be returned again by Execute.
+func (o *Output) Define(name, text string) error {
+	return o.define(name, name, text)
+}
+
+// DefineFile is like Define for an output template read from a file.
+func (o *Output) DefineFile(name, file string) error {
+	if o.set == nil {
+		return errors.New("output templates are defined before Parse")
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		o.errors[name] = err
+		return err
+	}
+	return o.define(name, file, string(content))
+}
+
+func (o *Output) define(name, templateName, text string) error {
+	if o.set == nil {
+		return errors.New("output templates are defined before Parse")
+	}
+	t, err := o.parseOutput(o.set, templateName, text)
+	if err != nil {
+		o.errors[name] = err
+		return err
+	}
+	o.outputs[name] = t
+	return nil
+}
+
+// parseOutput parses an output template prefixed with the common template in a
+// copy of set. When it does not parse, the error of the output template alone
+// is returned if it has one, so that its line numbers are right.
+func (o Output) parseOutput(set *template.Template, templateName, text string) (*template.Template, error) {
+	full := text
 	if o.commonTemplate != "" {
-		fullTpl = strings.Join(append([]string{o.commonTemplate}, tmpl), "\n")
+		full = o.commonTemplate + "\n" + text
+	}
+	t, err := parseClone(set, templateName, full)
+	if err != nil && full != text {
+		if _, alone := parseClone(set, templateName, text); alone != nil {
+			return nil, alone
+		}
 	}
+	return t, err
+}
 
-	parsed, err := template.New("main").Funcs(funcMap).Parse(fullTpl)
+func parseClone(set *template.Template, templateName, text string) (*template.Template, error) {
+	clone, err := set.Clone()
 	if err != nil {
-		l.Error("Failed to parse template", "error", err)
+		return nil, err
+	}
+	return clone.New(templateName).Parse(text)
+}
+
+// Execute renders the output defined as name.
+func (o Output) Execute(name string, vars map[string]any) (string, error) {
+	if err := o.errors[name]; err != nil {
 		return "", err
 	}
+	t, ok := o.outputs[name]
+	if !ok {
+		return "", fmt.Errorf("no output template %q", name)
+	}
+	return o.execute(t, vars)
+}
+
+// NoValue is what a template renders for a missing field outside of Strict
+// mode.
+const NoValue = "<no value>"
 
+// ErrNoValue is returned in Strict mode for an output holding NoValue, which a
+// function or a nil capture may still produce.
+var ErrNoValue = errors.New("rendered output contains " + NoValue)
+
+func (o Output) execute(t *template.Template, vars map[string]any) (string, error) {
+	t.Funcs(o.funcMap())
+	t.Option("missingkey=default")
+	if o.Strict {
+		t.Option("missingkey=error")
+	}
 	var buf bytes.Buffer
-	if err := parsed.Execute(&buf, vars); err != nil {
-		l.Error("Failed to execute template", "error", err)
+	if err := t.Execute(&buf, vars); err != nil {
+		logger.Get().Error("Failed to execute template", "error", err)
 		return "", err
 	}
-
+	if o.Strict && strings.Contains(buf.String(), NoValue) {
+		return "", fmt.Errorf("%w: %q", ErrNoValue, buf.String())
+	}
 	return buf.String(), nil
 }
+
+// FromTemplate renders the output template (prefixed with CommonTemplate if set)
+// using the provided variables and returns the result as a string. Unlike
+// Define and Execute, it parses the templates on every call.
+func (o Output) FromTemplate(tmpl string, vars map[string]any) (string, error) {
+	set, err := o.parseSet(nil)
+	var t *template.Template
+	if err == nil {
+		t, err = o.parseOutput(set, "main", tmpl)
+	}
+	if err != nil {
+		logger.Get().Error("Failed to parse template", "error", err)
+		return "", err
+	}
+	return o.execute(t, vars)
+}
@@ -4,9 +4,17 @@
 package output
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fileganizer/amounts"
+	"fileganizer/dates"
+	"fileganizer/sanitize"
 )
 
 var months = map[string][]string{
@@ -73,9 +81,233 @@ func TestMonthIndex_NoMatch(t *testing.T) {
 	assert.Equal(t, "NotAMonth", result)
 }
 
+func TestMonthIndex_LikeParseDate(t *testing.T) {
+	o := New("", map[string][]string{"fr": {"janvier", "février", "mars"}})
+
+	assert.Equal(t, "02", o.MonthIndex("fevrier"))
+	assert.Equal(t, "02", o.MonthIndex("Févr."))
+	assert.Equal(t, "03", o.MonthIndex("MARS"))
+}
+
 func TestMonthIndex_EmptyMonths(t *testing.T) {
 	o := New("", map[string][]string{})
 
 	result := o.MonthIndex("January")
 	assert.Equal(t, "January", result)
 }
+
+func TestFromTemplate_FindAllHelpers(t *testing.T) {
+	o := New("", nil)
+	items := []map[string]any{{"amount": "150"}, {"amount": 250.5}, {"other": "x"}}
+
+	r, err := o.FromTemplate(`{{ len .items }} {{ sum .items "amount" }} {{ (last .items).other }}`, map[string]any{"items": items})
+	assert.NoError(t, err)
+	assert.Equal(t, "3 400.5 x", r)
+}
+
+func TestSum_Invalid(t *testing.T) {
+	_, err := Sum([]map[string]any{{"amount": "abc"}}, "amount")
+	assert.Error(t, err)
+}
+
+func TestLast_Empty(t *testing.T) {
+	assert.Empty(t, Last(nil))
+}
+
+func TestFromTemplate_TypedHelpers(t *testing.T) {
+	o := New("", nil)
+	issued := time.Date(2014, time.March, 27, 0, 0, 0, 0, time.UTC)
+	due := time.Date(2014, time.April, 26, 0, 0, 0, 0, time.UTC)
+	vars := map[string]any{"total": 1200.5, "n": int64(7), "s": "42", "issued": issued, "due": due}
+
+	r, err := o.FromTemplate(`{{ if gt .total 1000.0 }}big{{ end }} {{ printf "%04d" .n }} {{ toInt .total }} `+
+		`{{ toFloat .s }} {{ .issued | dateFormat "2006/01/02" }} {{ daysBetween .issued .due }}`, vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "big 0007 1200 42 2014/03/27 30", r)
+}
+
+func TestToFloat_Invalid(t *testing.T) {
+	_, err := ToFloat(true)
+	assert.Error(t, err)
+	_, err = ToInt("abc")
+	assert.Error(t, err)
+
+	i, err := ToInt(3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), i)
+}
+
+func TestLibrary(t *testing.T) {
+	data := map[string]any{
+		"vendor":  "  ACME corp ",
+		"number":  "42",
+		"total":   "12.50",
+		"date":    "27/03/2014",
+		"path":    "/tmp/scans/Invoice 001.PDF",
+		"company": "Société Générale, Paris",
+		"items":   3,
+	}
+	tests := map[string]string{
+		`{{ .vendor | trim | replace " " "_" }}`:                         "ACME_corp",
+		`{{ trimAll "-" "--x--" }}`:                                      "x",
+		`{{ .date | regexReplace "(\\d+)/(\\d+)/(\\d+)" "$3-$2-$1" }}`:   "2014-03-27",
+		`{{ .missing | default "none" }} {{ .number | default "none" }}`: "none 42",
+		`{{ padLeft 5 "0" .number }}|{{ padRight 4 "." .items }}`:        "00042|3...",
+		`{{ .date | split "/" | join "-" }}`:                             "27-03-2014",
+		`{{ .vendor | trim | title }}`:                                   "Acme Corp",
+		`{{ substr 0 3 "février" }} {{ substr 4 -1 "février" }}`:         "fév ier",
+		`{{ add .number 1 }} {{ sub .items 5 }} {{ mul .total 2 }}`:      "43 -2 25",
+		`{{ div .total 2 }} {{ mod 7 .items }}`:                          "6.25 1",
+		`{{ .date | dateParse "02/01/2006" | dateFormat "2006-01-02" }}`: "2014-03-27",
+		`{{ basename .path }} {{ dirname .path }} {{ ext .path }}`:       "Invoice 001.PDF /tmp/scans .PDF",
+		`{{ slugify .company }}`:                                         "societe-generale-paris",
+	}
+	for tpl, wants := range tests {
+		r, err := New("", nil).FromTemplate(tpl, data)
+		assert.NoErrorf(t, err, "Fails on template '%s'", tpl)
+		assert.Equalf(t, wants, r, "Fails on template '%s'", tpl)
+	}
+
+	for _, tpl := range []string{
+		`{{ div 1 0 }}`,
+		`{{ mod 1.5 2 }}`,
+		`{{ add "x" 1 }}`,
+		`{{ "x" | regexReplace "(" "" }}`,
+		`{{ "2014" | dateParse "02/01/2006" }}`,
+		`{{ join "," 42 }}`,
+	} {
+		_, err := New("", nil).FromTemplate(tpl, data)
+		assert.Errorf(t, err, "Template '%s' should fail", tpl)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	o := New("", months)
+	r, err := o.FromTemplate(`{{ parseDate "27 mars 2014" | dateFormat "2006-01-02" }} {{ (parseDate "03/04/14").Month }}`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2014-03-27 April", r)
+
+	o.DateOrder = dates.MonthFirst
+	r, err = o.FromTemplate(`{{ (parseDate .d).Month }} {{ (parseDate .t).Year }}`,
+		map[string]any{"d": "03/04/14", "t": time.Date(1999, time.August, 15, 0, 0, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	assert.Equal(t, "March 1999", r)
+
+	_, err = o.FromTemplate(`{{ parseDate "27 foo 2014" }}`, nil)
+	assert.Error(t, err)
+}
+
+func TestSanitizeFunctions(t *testing.T) {
+	o := New("", nil)
+	o.Sanitize.Root = "/archive"
+	r, err := o.FromTemplate(`{{ sanitize .vendor }}|{{ sanitizePath .path }}|{{ safePath (sanitize .vendor) "a.pdf" }}`,
+		map[string]any{"vendor": "ACME / Globex: Inc.", "path": "../2014/ACME: Inc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ACME _ Globex_ Inc|2014/ACME_ Inc|/archive/ACME _ Globex_ Inc/a.pdf", r)
+
+	_, err = o.FromTemplate(`{{ safePath "../etc" }}`, nil)
+	assert.ErrorIs(t, err, sanitize.ErrOutsideRoot)
+}
+
+func TestDefineAndExecute(t *testing.T) {
+	dir := t.TempDir()
+	library := filepath.Join(dir, "library.tmpl")
+	require.NoError(t, os.WriteFile(library, []byte(`{{ define "name" }}{{ .vendor | ToUpper }}{{ end }}`), 0o600))
+	outputFile := filepath.Join(dir, "output.tmpl")
+	require.NoError(t, os.WriteFile(outputFile, []byte(`file {{ template "name" . }}`), 0o600))
+
+	o := New(`{{ define "year" }}{{ .year }}{{ end }}common`, nil)
+	require.NoError(t, o.Parse([]string{library}))
+	require.NoError(t, o.Define("a", `{{ define "local" }}a{{ end }}{{ template "name" . }} {{ template "year" . }} {{ template "local" }}`))
+	require.NoError(t, o.DefineFile("b", outputFile))
+	require.NoError(t, o.Define("c", `{{ template "local" }}`))
+	assert.Error(t, o.Define("d", `{{ end }}`))
+
+	r, err := o.Execute("a", map[string]any{"vendor": "acme", "year": 2014})
+	require.NoError(t, err)
+	assert.Equal(t, "common\nACME 2014 a", r)
+	r, err = o.Execute("b", map[string]any{"vendor": "globex"})
+	require.NoError(t, err)
+	assert.Equal(t, "common\nfile GLOBEX", r)
+
+	_, err = o.Execute("c", nil)
+	assert.Error(t, err, "templates defined by an output are not shared")
+	_, err = o.Execute("d", nil)
+	assert.Error(t, err, "the parse error is returned again")
+	_, err = o.Execute("unknown", nil)
+	assert.ErrorContains(t, err, "no output template")
+	assert.Error(t, o.DefineFile("e", filepath.Join(dir, "missing.tmpl")))
+}
+
+func TestParseErrorsTellFileAndLine(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.tmpl")
+	require.NoError(t, os.WriteFile(broken, []byte("line 1\nline 2 {{ end }}\n"), 0o600))
+
+	o := New("common\ntemplate\n", nil)
+	err := o.Parse([]string{broken})
+	assert.ErrorContains(t, err, broken+":2:")
+
+	require.NoError(t, o.Parse(nil))
+	err = o.DefineFile("broken", broken)
+	assert.ErrorContains(t, err, broken+":2:", "lines are counted in the file, not after the common template")
+
+	early := New("", nil)
+	assert.Error(t, early.Define("early", "x"), "Parse comes first")
+}
+
+func TestStrict(t *testing.T) {
+	o := New("", nil)
+	r, err := o.FromTemplate("{{ .missing }} {{ .empty }}", map[string]any{"empty": nil})
+	assert.NoError(t, err)
+	assert.Equal(t, "<no value> <no value>", r)
+
+	o.Strict = true
+	_, err = o.FromTemplate("{{ .missing }}", map[string]any{})
+	assert.ErrorContains(t, err, `map has no entry for key "missing"`)
+	_, err = o.FromTemplate("{{ .empty }}", map[string]any{"empty": nil})
+	assert.ErrorIs(t, err, ErrNoValue)
+	r, err = o.FromTemplate(`{{ index . "missing" | default "none" }}`, map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, "none", r)
+}
+
+func TestNow(t *testing.T) {
+	o := New("", nil)
+	o.Clock = func() time.Time { return time.Date(2024, 3, 27, 15, 4, 5, 0, time.UTC) }
+	r, err := o.FromTemplate(`{{ NowYYYY }} {{ NowYYYYMMDD }} {{ NowYYYYMMDD_HHMMSS }} {{ now | dateFormat "15:04 MST" }}`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024 20240327 20240327_150405 15:04 UTC", r)
+
+	o.Location = time.FixedZone("UTC-10", -10*60*60)
+	r, err = o.FromTemplate(`{{ NowYYYYMMDD_HHMMSS }} {{ now.Weekday }}`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "20240327_050405 Wednesday", r)
+
+	o.Clock = nil
+	o.Location = nil
+	assert.WithinDuration(t, time.Now(), o.Now(), time.Minute)
+}
+
+func TestAmounts(t *testing.T) {
+	o := New("", nil)
+	o.Amounts = amounts.Parser{Decimal: amounts.DecimalComma, Currency: "EUR"}
+	vars := map[string]any{
+		"total": amounts.Amount{Value: "1234.56", Currency: "USD"},
+		"ratio": 1234.567,
+		"count": int64(3),
+	}
+	r, err := o.FromTemplate(`{{ .total }} {{ .total | formatAmount "de" }} {{ .total.Currency }} {{ add .total 1 }}`, vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "1234.56USD 1.234,56 USD 1235.56", r)
+
+	r, err = o.FromTemplate(`{{ parseAmount "1.234,5" }} {{ parseAmount .ratio }} {{ parseAmount .count }} `+
+		`{{ "£12,30" | formatAmount "en" }}`, vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "1234.5EUR 1234.567EUR 3EUR 12.30", r)
+
+	_, err = o.FromTemplate(`{{ parseAmount "total" }}`, vars)
+	assert.ErrorContains(t, err, `no amount in "total"`)
+	_, err = o.FromTemplate(`{{ .total | formatAmount "xx" }}`, vars)
+	assert.ErrorContains(t, err, "locale must be")
+}
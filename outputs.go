@@ -0,0 +1,608 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.yaml.in/yaml/v3"
+
+	"fileganizer/config"
+	"fileganizer/logger"
+	"fileganizer/output"
+)
+
+// stepList is a list of steps run in order: the outputs of a description, or
+// the hooks of an event, of a description or global when fd is nil. Its
+// commands are run with exec, and its templates that fail to render are
+// handled by the templateErrors policy.
+type stepList struct {
+	fd             *config.FileDescription
+	event          string
+	steps          []config.OutputStep
+	exec           config.Exec
+	templateErrors string
+}
+
+// outputList returns the ordered outputs of a description. A description
+// with a single output has a single command step.
+func outputList(fd *config.FileDescription) stepList {
+	l := stepList{fd: fd, steps: fd.Outputs, exec: fd.Exec, templateErrors: fd.TemplateErrors}
+	if len(fd.Outputs) == 0 {
+		l.steps = []config.OutputStep{{Action: config.ActionCommand, Template: fd.Output, Args: fd.OutputArgs}}
+	}
+	return l
+}
+
+// single tells whether the list is the single output of a description.
+func (l stepList) single() bool {
+	return l.fd != nil && l.event == "" && len(l.fd.Outputs) == 0
+}
+
+// where tells which steps the list holds, in errors: outputs, hooks.onError...
+func (l stepList) where() string {
+	if l.event == "" {
+		return "outputs"
+	}
+	return "hooks." + l.event
+}
+
+// stepName is the name of the template of the step i, the name of the
+// description itself for a single output.
+func (l stepList) stepName(i int) string {
+	switch {
+	case l.single():
+		return l.fd.Name
+	case l.fd == nil:
+		return fmt.Sprintf("%s[%d]", l.where(), i)
+	default:
+		return fmt.Sprintf("%s.%s[%d]", l.fd.Name, l.where(), i)
+	}
+}
+
+// stepError reports the failure of the step i.
+func (l stepList) stepError(i int, err error) error {
+	switch {
+	case l.single():
+		return err
+	case l.fd == nil:
+		return fmt.Errorf("%s[%d]: %w", l.where(), i, err)
+	default:
+		return fmt.Errorf("file description %s, %s[%d]: %w", l.fd.Name, l.where(), i, err)
+	}
+}
+
+// owner returns the attributes of the logs about the list.
+func (l stepList) owner() []any {
+	var attrs []any
+	if l.fd != nil {
+		attrs = append(attrs, "fileDescription", l.fd.Name)
+	}
+	if l.event != "" {
+		attrs = append(attrs, "hook", l.event)
+	}
+	return attrs
+}
+
+// attrs returns the attributes of the logs about the step i.
+func (l stepList) attrs(i int, step config.OutputStep) []any {
+	return append(l.owner(), "step", i, "action", step.Action)
+}
+
+// argName is the name of the template of the argument j of a step.
+func argName(name string, j int) string {
+	return fmt.Sprintf("%s.args[%d]", name, j)
+}
+
+// defineSteps parses the templates of a list of steps, and of their
+// conditions. A template that does not parse is reported now, and again when
+// it is rendered.
+func defineSteps(o *output.Output, l stepList) {
+	for i, step := range l.steps {
+		name := l.stepName(i)
+		if err := defineStep(o, l, name, step); err != nil {
+			logger.Get().Warn("Failed to parse output template", append(l.attrs(i, step), "error", err)...)
+		}
+		if step.When == "" {
+			continue
+		}
+		if err := o.Define(name+".when", step.When); err != nil {
+			logger.Get().Warn("Failed to parse output condition", append(l.attrs(i, step), "error", err)...)
+		}
+	}
+}
+
+func defineStep(o *output.Output, l stepList, name string, step config.OutputStep) error {
+	switch {
+	case step.Args != nil:
+		var errs []error
+		for j, arg := range step.Args {
+			errs = append(errs, o.Define(argName(name, j), arg))
+		}
+		return errors.Join(errs...)
+	case l.single() && l.fd.OutputFile != "":
+		return o.DefineFile(name, l.fd.OutputFile)
+	default:
+		return o.Define(name, step.Template)
+	}
+}
+
+// runSteps renders the steps of a list in order, and prints or runs each of
+// them. A step that fails to render is handled by the template errors policy
+// and ends the list. Every step is recorded in the report of ctx.
+func runSteps(ctx context.Context, cfg *config.Config, o *output.Output, l stepList, values map[string]any) error {
+	for i, step := range l.steps {
+		name := l.stepName(i)
+		enabled, err := stepEnabled(o, name, step, values)
+		if err != nil {
+			return renderFailed(ctx, l, i, step, err)
+		}
+		if !enabled {
+			logger.Get().Debug("Output step skipped", l.attrs(i, step)...)
+			record(ctx, l, i, step, stepReport{Status: statusSkipped})
+			continue
+		}
+		rendered, argv, err := renderStep(o, l.exec, name, step, values)
+		if err != nil {
+			return renderFailed(ctx, l, i, step, err)
+		}
+		command := dryRun(cfg, step, rendered, argv)
+		if err := checkRoot(cfg, step, rendered); err != nil {
+			logger.Get().Warn("Output step failed", append(l.attrs(i, step), "error", err)...)
+			record(ctx, l, i, step, stepReport{Status: statusFailed, Command: command, Error: err.Error()})
+			return l.stepError(i, failedStep{name: name, err: err})
+		}
+		if !cfg.NoDryRun {
+			fmt.Print(command)
+			record(ctx, l, i, step, stepReport{Status: statusPrinted, Command: command})
+			followMove(cfg, step, rendered, values)
+			continue
+		}
+		if err := runRendered(ctx, cfg, l, i, step, rendered, argv, command, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderFailed applies the template errors policy to the step i, which failed
+// to render, and records it as failed, or skipped when the policy skips it.
+func renderFailed(ctx context.Context, l stepList, i int, step config.OutputStep, err error) error {
+	s := stepReport{Status: statusSkipped, Error: err.Error()}
+	err = templateError(l, err)
+	if err != nil {
+		s.Status = statusFailed
+	}
+	record(ctx, l, i, step, s)
+	return err
+}
+
+// runRendered runs the step i, once rendered, then logs and records its
+// result with the command it stands for. A step that fails ends the list unless it continues on error.
+func runRendered(ctx context.Context, cfg *config.Config, l stepList, i int, step config.OutputStep,
+	rendered string, argv []string, command string, values map[string]any,
+) error {
+	captures, _ := values["grok"].(map[string]any)
+	result, err := runStep(ctx, cfg, l.exec, step, rendered, argv, captures)
+	record(ctx, l, i, step, result.report(command, err))
+	attrs := append(l.attrs(i, step), result.attrs()...)
+	if err == nil {
+		logger.Get().Info("Output step done", attrs...)
+		followMove(cfg, step, rendered, values)
+		return nil
+	}
+	logger.Get().Warn("Output step failed", append(attrs, "continueOnError", step.ContinueOnError, "error", err)...)
+	if step.ContinueOnError {
+		return nil
+	}
+	return l.stepError(i, failedStep{name: l.stepName(i), result: result, err: err})
+}
+
+// checkRoot checks that the path a native action writes to stays in the
+// destination root, when one is configured, whatever the captures hold.
+func checkRoot(cfg *config.Config, step config.OutputStep, rendered string) error {
+	switch step.Action {
+	case config.ActionMkdir:
+		return cfg.Sanitize.Contains(rendered)
+	case config.ActionMove, config.ActionCopy:
+		return cfg.Sanitize.Contains(destinationPath(cfg.InputFile, rendered))
+	default:
+		return nil
+	}
+}
+
+// followMove records where a move step put the input file, so that the next
+// steps, descriptions and hooks work on it there.
+func followMove(cfg *config.Config, step config.OutputStep, rendered string, values map[string]any) {
+	if step.Action != config.ActionMove {
+		return
+	}
+	cfg.InputFile = destinationPath(cfg.InputFile, rendered)
+	if _, ok := values["filename"]; ok {
+		values["filename"] = cfg.InputFile
+	}
+}
+
+// failedStep is the error of a step that ran and failed, with its report for
+// the onError hooks.
+type failedStep struct {
+	name   string
+	result stepResult
+	err    error
+}
+
+func (e failedStep) Error() string {
+	return e.err.Error()
+}
+
+func (e failedStep) Unwrap() error {
+	return e.err
+}
+
+// templateError applies the policy of a list of steps to a step that failed
+// to render: it is skipped, skipped with a warning, or the run fails.
+func templateError(l stepList, err error) error {
+	attrs := append(l.owner(), "error", err)
+	switch {
+	case l.templateErrors == config.TemplateErrorsFail && l.fd == nil:
+		return fmt.Errorf("%s: %w", l.where(), err)
+	case l.templateErrors == config.TemplateErrorsFail:
+		return fmt.Errorf("file description %s: %w", l.fd.Name, err)
+	case l.templateErrors == config.TemplateErrorsWarn:
+		logger.Get().Warn("Skipping template", attrs...)
+	default:
+		logger.Get().Debug("Silently skipping template", attrs...)
+	}
+	return nil
+}
+
+// stepEnabled renders the condition of a step. The step runs unless it
+// renders an empty text or a false boolean.
+func stepEnabled(o *output.Output, name string, step config.OutputStep, values map[string]any) (bool, error) {
+	if step.When == "" {
+		return true, nil
+	}
+	rendered, err := o.Execute(name+".when", values)
+	if err != nil {
+		return false, err
+	}
+	rendered = strings.TrimSpace(rendered)
+	if b, err := strconv.ParseBool(rendered); err == nil {
+		return b, nil
+	}
+	return rendered != "", nil
+}
+
+var (
+	errEmptyCommand = errors.New("empty command")
+	errEmptyPath    = errors.New("empty path")
+)
+
+// renderStep renders the command or the path of a step, without the spaces
+// and line breaks around a path. A command run without a shell is returned as
+// its arguments: the rendered list of argument templates, or the rendered
+// command read as a YAML or JSON list in argv mode.
+func renderStep(o *output.Output, x config.Exec, name string, step config.OutputStep,
+	values map[string]any,
+) (string, []string, error) {
+	if step.Args != nil {
+		argv := make([]string, 0, len(step.Args))
+		for j := range step.Args {
+			arg, err := o.Execute(argName(name, j), values)
+			if err != nil {
+				return "", nil, err
+			}
+			argv = append(argv, arg)
+		}
+		return "", argv, checkArgv(argv)
+	}
+	rendered, err := o.Execute(name, values)
+	switch {
+	case err != nil:
+		return "", nil, err
+	case step.Action != config.ActionCommand:
+		rendered = strings.TrimSpace(rendered)
+		if rendered == "" {
+			return "", nil, errEmptyPath
+		}
+		return rendered, nil, nil
+	case x.Mode != config.ExecArgv:
+		return rendered, nil, nil
+	}
+	var argv []string
+	if err := yaml.Unmarshal([]byte(rendered), &argv); err != nil {
+		return "", nil, fmt.Errorf("argv output must be a YAML or JSON list of arguments: %w", err)
+	}
+	return rendered, argv, checkArgv(argv)
+}
+
+func checkArgv(argv []string) error {
+	if len(argv) == 0 || argv[0] == "" {
+		return errEmptyCommand
+	}
+	return nil
+}
+
+// dryRun returns what a step would do: the command itself, or the shell
+// command equivalent to a command run without a shell or to a native action.
+func dryRun(cfg *config.Config, step config.OutputStep, rendered string, argv []string) string {
+	switch step.Action {
+	case config.ActionMkdir:
+		return "mkdir -p " + shellQuote(rendered) + "\n"
+	case config.ActionMove:
+		return "mv -n " + shellQuote(cfg.InputFile) + " " + shellQuote(rendered) + "\n"
+	case config.ActionCopy:
+		return "cp -n " + shellQuote(cfg.InputFile) + " " + shellQuote(rendered) + "\n"
+	}
+	if argv == nil {
+		return rendered
+	}
+	quoted := make([]string, 0, len(argv))
+	for _, arg := range argv {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ") + "\n"
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Errors of the steps that ran.
+var (
+	errCommandFailed = errors.New("command failed")
+	errTimeout       = errors.New("timed out")
+)
+
+// waitDelay is how long a command that was stopped, or that exited, is given
+// to close its output, which its own children may hold open.
+const waitDelay = time.Second
+
+// stepResult is the report of a step that ran: the output and the exit code
+// of its command, -1 when it did not exit by itself, and how long it lasted.
+type stepResult struct {
+	command  bool
+	stdout   string
+	stderr   string
+	exitCode int
+	duration time.Duration
+}
+
+func (r stepResult) attrs() []any {
+	attrs := []any{"duration", r.duration}
+	if r.command {
+		attrs = append(attrs, "exitCode", r.exitCode, "stdout", r.stdout, "stderr", r.stderr)
+	}
+	return attrs
+}
+
+// runStep runs a rendered step: a command, or a native action on the input
+// file, within the timeout of the exec settings. A directory is created and a
+// file renamed at once; only commands and copies can be stopped halfway.
+func runStep(ctx context.Context, cfg *config.Config, x config.Exec, step config.OutputStep,
+	rendered string, argv []string, captures map[string]any,
+) (stepResult, error) {
+	if x.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, x.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	var result stepResult
+	var err error
+	switch step.Action {
+	case config.ActionMkdir:
+		err = os.MkdirAll(rendered, 0o750)
+	case config.ActionMove:
+		err = moveFile(ctx, cfg.InputFile, rendered)
+	case config.ActionCopy:
+		err = copyFile(ctx, cfg.InputFile, rendered)
+	default:
+		cmd := command(ctx, x, rendered, argv)
+		cmd.Env = environment(x, captures)
+		result, err = runCommand(cmd)
+	}
+	result.duration = time.Since(start)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s", errTimeout, x.Timeout)
+	}
+	return result, err
+}
+
+// runCommand runs a command, printing its standard output to ours and its
+// standard error to ours. A command that exits with another code than 0
+// fails with the last line it wrote to its standard error.
+func runCommand(cmd *exec.Cmd) (stepResult, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = waitDelay
+	err := cmd.Run()
+	result := stepResult{command: true, stdout: stdout.String(), stderr: stderr.String(), exitCode: -1}
+	if cmd.ProcessState != nil {
+		result.exitCode = cmd.ProcessState.ExitCode()
+	}
+	fmt.Print(result.stdout)
+	fmt.Fprint(os.Stderr, result.stderr)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && result.exitCode > 0 {
+		err = fmt.Errorf("%w with exit code %d", errCommandFailed, result.exitCode)
+		if lines := strings.Split(strings.TrimSpace(result.stderr), "\n"); lines[len(lines)-1] != "" {
+			err = fmt.Errorf("%w: %s", err, lines[len(lines)-1])
+		}
+	}
+	return result, err
+}
+
+// environment returns the environment of a command: the inherited variables,
+// the captures as FG_GROK_* variables when exported, then the variables of the
+// exec settings, which win.
+func environment(x config.Exec, captures map[string]any) []string {
+	var env []string
+	if x.InheritEnv == nil {
+		env = os.Environ()
+	}
+	for _, name := range x.InheritEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	if x.ExportCaptures {
+		for _, name := range slices.Sorted(maps.Keys(captures)) {
+			if value, ok := envValue(captures[name]); ok {
+				env = append(env, "FG_GROK_"+envName(name)+"="+value)
+			}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(x.Env)) {
+		env = append(env, name+"="+x.Env[name])
+	}
+	return env
+}
+
+// envName converts the name of a capture to the name of a variable:
+// invoiceNumber gives INVOICE_NUMBER.
+func envName(name string) string {
+	var b strings.Builder
+	var previous rune
+	for _, r := range name {
+		switch {
+		case r >= utf8.RuneSelf || !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			b.WriteByte('_')
+		case unicode.IsUpper(r) && (unicode.IsLower(previous) || unicode.IsDigit(previous)):
+			b.WriteByte('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+		previous = r
+	}
+	return b.String()
+}
+
+// envValue returns the text of a capture as a variable. Dates without a time
+// are written 2006-01-02. Lists and maps are not exported.
+func envValue(v any) (string, bool) {
+	switch e := v.(type) {
+	case nil, []any, map[string]any, []map[string]any:
+		return "", false
+	case time.Time:
+		if e.Equal(e.Truncate(24 * time.Hour)) { //nolint:mnd
+			return e.Format(time.DateOnly), true
+		}
+		return e.Format(time.RFC3339), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// command returns the command of a step: argv when it is run without a shell,
+// else the interpreter with the rendered command as last argument, in the
+// directory of the exec settings.
+func command(ctx context.Context, x config.Exec, rendered string, argv []string) *exec.Cmd {
+	if argv == nil {
+		interpreter := x.Interpreter
+		if len(interpreter) == 0 {
+			interpreter = config.DefaultInterpreter
+		}
+		argv = append(slices.Clone(interpreter), rendered)
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...) //nolint:gosec
+	cmd.Dir = x.Dir
+	return cmd
+}
+
+// destinationPath returns the path a file is moved or copied to: into dest
+// when it is a directory or ends with a slash.
+func destinationPath(src, dest string) string {
+	if strings.HasSuffix(dest, string(filepath.Separator)) {
+		return filepath.Join(dest, filepath.Base(src))
+	}
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		return filepath.Join(dest, filepath.Base(src))
+	}
+	return dest
+}
+
+// destination returns the path a file is moved or copied to, creating the
+// missing parent directories. An existing file is never replaced.
+func destination(src, dest string) (string, error) {
+	dest = destinationPath(src, dest)
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("%s already exists", dest)
+	}
+	return dest, os.MkdirAll(filepath.Dir(dest), 0o750)
+}
+
+// moveFile renames a file, or copies it then removes it when dest is on
+// another file system. Only the copy can be stopped by ctx.
+func moveFile(ctx context.Context, src, dest string) error {
+	dest, err := destination(src, dest)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(src, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(ctx, src, dest); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies a file. When ctx is done during the copy, the partial copy
+// is removed.
+func copyFile(ctx context.Context, src, dest string) error {
+	dest, err := destination(src, dest)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, contextReader{ctx, in}); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
+
+// contextReader stops reading when its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,102 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"fileganizer/config"
+)
+
+// Statuses of the steps in the report.
+const (
+	statusSkipped = "skipped"
+	statusPrinted = "printed"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+// report is the result of a run, written as JSON with --report: every step
+// that was considered, with what it printed or how it ran, and the exit code
+// of fileganizer.
+type report struct {
+	File     string       `json:"file"`
+	DryRun   bool         `json:"dryRun"`
+	Steps    []stepReport `json:"steps"`
+	ExitCode int          `json:"exitCode"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// stepReport is the result of one step. ExitCode, Stdout and Stderr are the
+// ones of a command that ran, and Duration tells how long a step that ran
+// lasted.
+type stepReport struct {
+	FileDescription string `json:"fileDescription,omitempty"`
+	Hook            string `json:"hook,omitempty"`
+	Step            int    `json:"step"`
+	Action          string `json:"action"`
+	Status          string `json:"status"`
+	Command         string `json:"command,omitempty"`
+	ExitCode        *int   `json:"exitCode,omitempty"`
+	Stdout          string `json:"stdout,omitempty"`
+	Stderr          string `json:"stderr,omitempty"`
+	Duration        string `json:"duration,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+type reportKey struct{}
+
+// withReport returns a copy of ctx where the steps are recorded in r.
+func withReport(ctx context.Context, r *report) context.Context {
+	return context.WithValue(ctx, reportKey{}, r)
+}
+
+// record adds the result of the step i of a list to the report of ctx, if any.
+func record(ctx context.Context, l stepList, i int, step config.OutputStep, s stepReport) {
+	r, ok := ctx.Value(reportKey{}).(*report)
+	if !ok {
+		return
+	}
+	if l.fd != nil {
+		s.FileDescription = l.fd.Name
+	}
+	s.Hook, s.Step, s.Action = l.event, i, step.Action
+	s.Command = strings.TrimSuffix(s.Command, "\n")
+	r.Steps = append(r.Steps, s)
+}
+
+// report returns the report of a step that ran.
+func (r stepResult) report(command string, err error) stepReport {
+	s := stepReport{Status: statusDone, Command: command, Duration: r.duration.String()}
+	if r.command {
+		s.ExitCode, s.Stdout, s.Stderr = &r.exitCode, r.stdout, r.stderr
+	}
+	if err != nil {
+		s.Status, s.Error = statusFailed, err.Error()
+	}
+	return s
+}
+
+// write ends the report with the outcome of the run and writes it to a file.
+func (r *report) write(file string, err error) error {
+	r.ExitCode = exitCode(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if r.Steps == nil {
+		r.Steps = []stepReport{}
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	return os.WriteFile(file, b.Bytes(), 0o600)
+}
@@ -0,0 +1,234 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+// Package sanitize makes captured text safe to use in file names and paths.
+package sanitize
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"fileganizer/accents"
+)
+
+// Defaults of a Policy.
+const (
+	DefaultReplacement = "_"
+	DefaultMaxLength   = 255
+)
+
+// ErrOutsideRoot is returned by Policy.SafePath for a path that leaves the
+// destination root.
+var ErrOutsideRoot = errors.New("path is outside of the destination root")
+
+// Policy tells how text is made safe. Replacement stands for the forbidden
+// characters, ASCII transliterates accented letters, MaxLength is the length in
+// bytes of a path component and Root is the directory that SafePath keeps
+// paths in.
+type Policy struct {
+	Replacement string
+	ASCII       bool
+	MaxLength   int
+	Root        string
+}
+
+// DefaultPolicy returns the policy used when the configuration sets nothing.
+func DefaultPolicy() Policy {
+	return Policy{Replacement: DefaultReplacement, MaxLength: DefaultMaxLength}
+}
+
+// forbidden are the characters that are not allowed in a file name on at least
+// one of the usual file systems, or that have a meaning for a shell.
+const forbidden = `/\:*?"<>|` + "`$"
+
+// Component returns s as a single file name: decomposed accents are composed,
+// forbidden and control characters are replaced, runs of whitespace become a
+// single space, leading and trailing spaces and dots are removed, and the name
+// is cut to MaxLength bytes, keeping its extension. "." and ".." are replaced.
+func (p Policy) Component(s string) string {
+	s = compose(s)
+	if p.ASCII {
+		s = accents.Remove(s)
+	}
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case space && b.Len() > 0:
+			b.WriteByte(' ')
+		}
+		space = false
+		switch {
+		case strings.ContainsRune(forbidden, r), unicode.IsControl(r), r == utf8.RuneError:
+			b.WriteString(p.Replacement)
+		case p.ASCII && r >= utf8.RuneSelf:
+			b.WriteString(p.Replacement)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	name := strings.Trim(b.String(), " .")
+	if name == "" && strings.TrimSpace(s) != "" {
+		name = p.Replacement
+	}
+	return p.truncate(name)
+}
+
+// truncate cuts name to MaxLength bytes on a rune boundary, keeping a short
+// extension.
+func (p Policy) truncate(name string) string {
+	if p.MaxLength <= 0 || len(name) <= p.MaxLength {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) >= p.MaxLength/2 {
+		ext = ""
+	}
+	base := name[:len(name)-len(ext)]
+	limit := p.MaxLength - len(ext)
+	for limit > 0 && !utf8.RuneStart(base[limit]) {
+		limit--
+	}
+	return strings.TrimRight(base[:limit], " .") + ext
+}
+
+// Path sanitizes each component of a slash-separated path. Empty, "." and ".."
+// components are dropped, so that the result never goes up a directory; a
+// leading slash is kept.
+func (p Policy) Path(s string) string {
+	parts := strings.Split(filepath.ToSlash(s), "/")
+	kept := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part == "." || part == ".." {
+			continue
+		}
+		if part = p.Component(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	path := strings.Join(kept, "/")
+	if strings.HasPrefix(s, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// SafePath joins the parts of a path under Root and checks that the result
+// stays in it. Parts are not sanitized, only checked: sanitize them first.
+func (p Policy) SafePath(parts ...string) (string, error) {
+	if p.Root == "" {
+		return "", errors.New("no destination root configured")
+	}
+	root := filepath.Clean(p.Root)
+	path := filepath.Join(append([]string{root}, parts...)...)
+	if !within(root, path) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, path)
+	}
+	return path, nil
+}
+
+// Contains checks that path, from the working directory when it is relative,
+// stays in Root. Any path does when no root is configured.
+func (p Policy) Contains(path string) error {
+	if p.Root == "" {
+		return nil
+	}
+	root, err := filepath.Abs(p.Root)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if !within(root, abs) {
+		return fmt.Errorf("%w: %s", ErrOutsideRoot, abs)
+	}
+	return nil
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Values returns a copy of captures where every text is sanitized as a file
+// name component, in lists too.
+func (p Policy) Values(captures map[string]any) map[string]any {
+	result := make(map[string]any, len(captures))
+	for k, v := range captures {
+		result[k] = p.value(v)
+	}
+	return result
+}
+
+// Lists is like Values for the lists of captures collected with findAll.
+func (p Policy) Lists(lists map[string][]map[string]any) map[string][]map[string]any {
+	result := make(map[string][]map[string]any, len(lists))
+	for k, v := range lists {
+		result[k], _ = p.value(v).([]map[string]any)
+	}
+	return result
+}
+
+func (p Policy) value(v any) any {
+	switch e := v.(type) {
+	case string:
+		return p.Component(e)
+	case []any:
+		list := make([]any, 0, len(e))
+		for _, item := range e {
+			list = append(list, p.value(item))
+		}
+		return list
+	case map[string]any:
+		return p.Values(e)
+	case []map[string]any:
+		list := make([]map[string]any, 0, len(e))
+		for _, item := range e {
+			list = append(list, p.Values(item))
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+// compositions gives, for the combining marks of decomposed Latin letters,
+// the base letters and their composed forms.
+var compositions = map[rune][2]string{
+	'\u0300': {"aeiouAEIOU", "àèìòùÀÈÌÒÙ"},
+	'\u0301': {"aeiouyAEIOUY", "áéíóúýÁÉÍÓÚÝ"},
+	'\u0302': {"aeiouAEIOU", "âêîôûÂÊÎÔÛ"},
+	'\u0303': {"anoANO", "ãñõÃÑÕ"},
+	'\u0308': {"aeiouyAEIOU", "äëïöüÿÄËÏÖÜ"},
+	'\u030a': {"aA", "åÅ"},
+	'\u0327': {"cC", "çÇ"},
+}
+
+// compose replaces the Latin letters followed by a combining accent, as some
+// PDF tools produce them, by the equivalent composed letters.
+func compose(s string) string {
+	runes := []rune(s)
+	composed := make([]rune, 0, len(runes))
+	for _, r := range runes {
+		if c, ok := compositions[r]; ok && len(composed) > 0 {
+			last := composed[len(composed)-1]
+			if i := strings.IndexRune(c[0], last); i >= 0 {
+				composed[len(composed)-1] = []rune(c[1])[utf8.RuneCountInString(c[0][:i])]
+				continue
+			}
+		}
+		composed = append(composed, r)
+	}
+	return string(composed)
+}
@@ -0,0 +1,103 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package sanitize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent(t *testing.T) {
+	p := DefaultPolicy()
+	tests := map[string]string{
+		"ACME / Globex: \"Europe\"": "ACME _ Globex_ _Europe_",
+		"  Société   Générale\t\n":  "Société Générale",
+		"Socie\u0301te\u0301":       "Société",
+		"a*b?c<d>e|f\\g":            "a_b_c_d_e_f_g",
+		"$(rm -rf) `x`":             "_(rm -rf) _x_",
+		"bell\a":                    "bell_",
+		"..":                        "_",
+		".hidden.":                  "hidden",
+		"":                          "",
+		"   ":                       "",
+	}
+	for s, wants := range tests {
+		assert.Equal(t, wants, p.Component(s), s)
+	}
+
+	p.ASCII = true
+	p.Replacement = "-"
+	assert.Equal(t, "Societe Generale-Zurich-", p.Component("Société Générale/Zürich™"))
+}
+
+func TestComponent_MaxLength(t *testing.T) {
+	p := Policy{Replacement: "_", MaxLength: 10}
+	assert.Equal(t, "abcdef.pdf", p.Component("abcdefghijklmnop.pdf"))
+	assert.Equal(t, "aéé.pdf", p.Component("aéééé.pdf"), "cut on a rune boundary")
+	assert.Equal(t, "abcdefghij", p.Component("abcdefghijklmnop"))
+	assert.Equal(t, "abcdefghij", p.Component("abcdefghijklmno.extension"), "long extensions are not kept")
+
+	p = DefaultPolicy()
+	long := p.Component(strings.Repeat("x", 300) + ".pdf")
+	assert.Len(t, long, DefaultMaxLength)
+	assert.True(t, strings.HasSuffix(long, ".pdf"))
+}
+
+func TestPath(t *testing.T) {
+	p := DefaultPolicy()
+	assert.Equal(t, "invoices/ACME_ Inc/2014", p.Path("invoices/ACME: Inc/2014"))
+	assert.Equal(t, "/data/a/b", p.Path("/data/../a/./b/"))
+	assert.Equal(t, "etc/passwd", p.Path("../../etc/passwd"))
+}
+
+func TestSafePath(t *testing.T) {
+	p := DefaultPolicy()
+	_, err := p.SafePath("a")
+	assert.Error(t, err)
+
+	p.Root = "/data/archive/"
+	path, err := p.SafePath("2014", "invoice.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "/data/archive/2014/invoice.pdf", path)
+	path, err = p.SafePath("a/../b")
+	require.NoError(t, err)
+	assert.Equal(t, "/data/archive/b", path)
+
+	for _, parts := range [][]string{{".."}, {"a", "../../etc"}, {"../archive2/x"}} {
+		_, err = p.SafePath(parts...)
+		assert.ErrorIs(t, err, ErrOutsideRoot, parts)
+	}
+}
+
+func TestContains(t *testing.T) {
+	p := DefaultPolicy()
+	assert.NoError(t, p.Contains("/etc/passwd"), "no root, no check")
+
+	p.Root = "/data/archive/"
+	assert.NoError(t, p.Contains("/data/archive/2014/invoice.pdf"))
+	assert.NoError(t, p.Contains("/data/archive"))
+	for _, path := range []string{"/data/archive/Dublin/../../etc/x", "/data/archive2/x", "relative/x"} {
+		assert.ErrorIs(t, p.Contains(path), ErrOutsideRoot, path)
+	}
+}
+
+func TestValues(t *testing.T) {
+	p := DefaultPolicy()
+	captures := map[string]any{
+		"vendor": "ACME/Globex",
+		"total":  12.5,
+		"list":   []any{"a:b", 3},
+		"lines":  []map[string]any{{"label": "x|y"}},
+	}
+	assert.Equal(t, map[string]any{
+		"vendor": "ACME_Globex",
+		"total":  12.5,
+		"list":   []any{"a_b", 3},
+		"lines":  []map[string]any{{"label": "x_y"}},
+	}, p.Values(captures))
+	assert.Equal(t, "ACME/Globex", captures["vendor"], "captures are not modified")
+}
@@ -0,0 +1,58 @@
+// Copyright 2023-2026 The Fileganizer Authors. All rights reserved.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"fileganizer/config"
+	"fileganizer/textextract"
+)
+
+// runSuggest implements the suggest subcommand: it infers a pattern capturing
+// a value known to be in the file and prints it as a patterns list entry.
+func runSuggest(ctx context.Context, args []string) error {
+	fs := pflag.NewFlagSet("fileganizer suggest", pflag.ContinueOnError)
+	configFile := fs.StringP("config", "c", "", "Configuration file")
+	inputFile := fs.StringP("file", "f", "", "File to scan")
+	value := fs.String("value", "", "Value known to be in the file")
+	name := fs.String("name", "value", "Name of the capture")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+	if *value == "" {
+		return errors.New("--value is required")
+	}
+
+	cfg, err := config.NewFromArgs(Version, []string{"-c", *configFile, "-f", *inputFile})
+	if err != nil {
+		return err
+	}
+	txt, err := textextract.TextExtract(ctx, cfg.InputFile, cfg.ExtractTextCommand)
+	if err != nil {
+		return err
+	}
+	g, err := newGrok(&cfg)
+	if err != nil {
+		return err
+	}
+	preferred := make(map[string]bool, len(cfg.GrokPatterns))
+	for k := range cfg.GrokPatterns {
+		preferred[k] = true
+	}
+	s, err := g.Suggest(txt, *value, *name, preferred)
+	if err != nil {
+		return err
+	}
+	quoted, err := config.QuotePattern(s.Pattern)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# %q found %d time(s), the pattern matches it once\n- %s\n", *value, s.Occurrences, quoted)
+	return nil
+}
@@ -26,3 +26,36 @@ func UseTempDir(t *testing.T) {
 		}
 	})
 }
+
+// Months are the month lists of the tests, as the months section of a
+// configuration gives them.
+var Months = map[string][]string{
+	"MONTHSFRENCH": {
+		"janvier",
+		"février",
+		"mars",
+		"avril",
+		"mai",
+		"juin",
+		"juillet",
+		"août",
+		"septembre",
+		"octobre",
+		"novembre",
+		"décembre",
+	},
+	"MONTHSENGLISH": {
+		"January",
+		"February",
+		"March",
+		"April",
+		"May",
+		"June",
+		"July",
+		"August",
+		"September",
+		"October",
+		"November",
+		"December",
+	},
+}